@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"sync"
 
 	"github.com/AndreRenaud/morphlet/warp"
@@ -12,8 +17,26 @@ import (
 )
 
 func main() {
-	frameCount := flag.Int("frames", 21, "Number of frames to generate")
+	if len(os.Args) > 1 && os.Args[1] == "suggest" {
+		suggest(os.Args[2:])
+		return
+	}
+
+	frameCount := flag.Int("frames", 21, "Number of frames to generate for each transition without its own timing")
+	fps := flag.Float64("fps", 0, "Frame rate for transitions timed in seconds. If 0, uses the job's fps")
 	jobFile := flag.String("job", "", "Json file containing warp job details (see warp/WarpJsonSaveFormat)")
+	filter := flag.String("filter", "bilinear", "Resampling filter: nearest, bilinear, bicubic, mitchell or lanczos")
+	antiAlias := flag.Bool("antialias", false, "Anti-alias triangle edges by supersampling their coverage")
+	linearBlend := flag.Bool("linear-blend", false, "Cross-dissolve in linear light rather than directly on sRGB values")
+	gridStep := flag.Int("grid", warp.DefaultGridStep, "Pixel spacing at which smooth warps (lines, tps, mls) evaluate their mapping")
+	border := flag.String("border", "clamp", "Sampling outside the source images: clamp, transparent, mirror, wrap or constant")
+	borderColor := flag.String("border-color", "000000ff", "RGBA hex colour used by -border constant")
+	trajectory := flag.String("trajectory", "", "Point paths through the images: linear, catmull-rom or centripetal. If empty, uses the job's trajectory")
+	hold := flag.Int("hold", -1, "Number of frames to show each image for before morphing away. If negative, uses the job's sequence")
+	loop := flag.String("loop", "", "Loop mode: none, ping-pong or wrap. If empty, uses the job's sequence")
+	blurSamples := flag.Int("blur-samples", -1, "Sub-frames averaged into each frame for motion blur. 0 or 1 disables it. If negative, uses the job's motion blur")
+	shutter := flag.Float64("shutter", 0, "Motion blur shutter angle in degrees (0-360). If 0, uses the job's shutter, or 180")
+	retriangulate := flag.Bool("retriangulate", false, "Triangulate every frame, rather than once per transition")
 	flag.Parse()
 
 	job, err := warp.NewJobFromFile(*jobFile)
@@ -31,8 +54,52 @@ func main() {
 		bar.Set(pos)
 	}
 	job.Callback = progressCB
+	job.PerFrameTriangulation = *retriangulate
+	job.AntiAlias = *antiAlias
+	if *fps > 0 {
+		job.FPS = *fps
+	}
+	job.GridStep = *gridStep
+	if *linearBlend {
+		job.BlendMode = warp.BlendLinear
+	}
+	if job.Sampler, err = warp.SamplerByName(*filter); err != nil {
+		log.Fatalf("Invalid filter: %s", err)
+	}
+	if *hold >= 0 {
+		job.Sequence.Hold = *hold
+	}
+	if *loop != "" {
+		if job.Sequence.Loop, err = warp.LoopModeByName(*loop); err != nil {
+			log.Fatalf("Invalid loop: %s", err)
+		}
+	}
+	if *blurSamples >= 0 {
+		job.MotionBlur.Samples = *blurSamples
+	}
+	if *shutter > 0 {
+		job.MotionBlur.Shutter = min(*shutter, 360)
+	}
+	if *trajectory != "" {
+		if job.Trajectory, err = warp.TrajectoryByName(*trajectory); err != nil {
+			log.Fatalf("Invalid trajectory: %s", err)
+		}
+	}
+	if job.Border.Mode, err = warp.BorderModeByName(*border); err != nil {
+		log.Fatalf("Invalid border: %s", err)
+	}
+	c := &job.Border.Color
+	if _, err := fmt.Sscanf(*borderColor, "%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); err != nil {
+		log.Fatalf("Invalid border colour %q: %s", *borderColor, err)
+	}
 
-	if err := job.Run("warped", *frameCount); err != nil {
+	// Stop cleanly on ^C, leaving only complete frames behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := job.RunContext(ctx, "warped", *frameCount); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Fatalf("Interrupted")
+		}
 		log.Fatalf("failed to run warp job: %v", err)
 	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/AndreRenaud/morphlet/warp"
+)
+
+// suggest implements the "suggest" subcommand, which detects matching
+// features across a job's images and adds them to its control points
+func suggest(args []string) {
+	flags := flag.NewFlagSet("suggest", flag.ExitOnError)
+	jobFile := flags.String("job", "", "Json file containing warp job details (see warp/WarpJsonSaveFormat)")
+	output := flags.String("o", "", "File to write the updated job to. If empty, the job file is updated in place")
+	maxPoints := flags.Int("points", 40, "Maximum number of correspondences to add")
+	maxFeatures := flags.Int("features", 500, "Number of corners to detect in each image")
+	ratio := flags.Float64("ratio", 0.8, "Lowe's ratio test threshold for accepting a match (0-1)")
+	threshold := flags.Float64("threshold", 0.1, "RANSAC inlier distance, as a fraction of the image diagonal")
+	flags.Parse(args)
+
+	job, err := warp.LoadWarpJson(*jobFile)
+	if err != nil {
+		log.Fatalf("Cannot load %s: %s", *jobFile, err)
+	}
+	added, err := job.SuggestPoints(warp.FeatureOptions{
+		MaxFeatures: *maxFeatures,
+		Ratio:       *ratio,
+		Threshold:   *threshold,
+		MaxPoints:   *maxPoints,
+	})
+	if err != nil {
+		log.Fatalf("Cannot suggest points: %s", err)
+	}
+	log.Printf("Added %d points", added)
+
+	if *output == "" {
+		*output = *jobFile
+	}
+	if err := warp.SaveWarpJson(job, *output); err != nil {
+		log.Fatalf("Cannot save %s: %s", *output, err)
+	}
+}
@@ -30,15 +30,24 @@ var (
 	textures                = make(map[string]*TextureWithSize)
 	draggingPoint   struct {
 		isDragging   bool
+		isLattice    bool // pointIndex refers to a lattice vertex, rather than a point
 		imageIndex   int
 		pointIndex   int
 		dragStartPos image.Point
 	}
-	lastClickTime float64
-	lastClickPos  image.Point
-	saveFilePath  string
+	lastClickTime  float64
+	lastClickPos   image.Point
+	saveFilePath   string
+	selectedMethod int32
 )
 
+// warpMethods are the names accepted by warp.WarpMethodByName, in the order
+// shown in the method selector
+var warpMethods = []string{"triangles", "lines", "tps", "mls", "mesh"}
+
+// latticeSize is the number of rows & columns in newly added lattices
+const latticeSize = 5
+
 func onNewProject() {
 	showProjectView = true
 	currentJob = &warp.WarpJobSaveFormat{
@@ -102,6 +111,10 @@ func imagePane() giu.Widget {
 					if len(currentJob.ImagePoints) > localI && len(currentJob.ImagePoints) > localI-1 {
 						currentJob.ImagePoints[localI], currentJob.ImagePoints[localI-1] = currentJob.ImagePoints[localI-1], currentJob.ImagePoints[localI]
 					}
+					if len(currentJob.ImageLattices) > localI {
+						currentJob.ImageLattices[localI], currentJob.ImageLattices[localI-1] = currentJob.ImageLattices[localI-1], currentJob.ImageLattices[localI]
+					}
+					swapPointFlags(localI, localI-1)
 
 					// Update selected image index if needed
 					if selectedImage == localI {
@@ -121,6 +134,10 @@ func imagePane() giu.Widget {
 					if len(currentJob.ImagePoints) > localI && len(currentJob.ImagePoints) > localI+1 {
 						currentJob.ImagePoints[localI], currentJob.ImagePoints[localI+1] = currentJob.ImagePoints[localI+1], currentJob.ImagePoints[localI]
 					}
+					if len(currentJob.ImageLattices) > localI+1 {
+						currentJob.ImageLattices[localI], currentJob.ImageLattices[localI+1] = currentJob.ImageLattices[localI+1], currentJob.ImageLattices[localI]
+					}
+					swapPointFlags(localI, localI+1)
 
 					// Update selected image index if needed
 					if selectedImage == localI {
@@ -132,8 +149,12 @@ func imagePane() giu.Widget {
 			}).Disabled(localI == len(currentJob.Images)-1), // Disable down button for last item
 			giu.Button("x").Size(25, 0).OnClick(func() {
 				// Remove the image and its points
+				removePointFlags(localI)
 				currentJob.Images = append(currentJob.Images[:localI], currentJob.Images[localI+1:]...)
 				currentJob.ImagePoints = append(currentJob.ImagePoints[:localI], currentJob.ImagePoints[localI+1:]...)
+				if len(currentJob.ImageLattices) > localI {
+					currentJob.ImageLattices = append(currentJob.ImageLattices[:localI], currentJob.ImageLattices[localI+1:]...)
+				}
 			}),
 			giu.Selectable(imgLabel).Selected(selectedImage == localI).OnClick(func() {
 				selectedImage = localI
@@ -160,6 +181,16 @@ func imagePane() giu.Widget {
 						}
 					}
 					currentJob.ImagePoints = append(currentJob.ImagePoints, newImagePoints)
+
+					// New images start with a copy of image 0's lattice
+					if len(currentJob.ImageLattices) > 0 {
+						lattice := currentJob.ImageLattices[0]
+						lattice.Points = nil
+						for _, point := range currentJob.ImageLattices[0].Points {
+							lattice.Points = append(lattice.Points, []int{point[0], point[1]})
+						}
+						currentJob.ImageLattices = append(currentJob.ImageLattices, lattice)
+					}
 				}
 			}),
 		),
@@ -169,10 +200,14 @@ func imagePane() giu.Widget {
 
 func comparisonPane() giu.Widget {
 	return giu.Custom(func() {
+		applySuggestion()
+		applyPropagation()
 		var layouts []giu.Widget
 
 		if currentJob == nil {
 			layouts = append(layouts, giu.Label("No project loaded"))
+		} else if previewing() {
+			layouts = append(layouts, previewPane())
 		} else if selectedImage == -1 {
 			layouts = append(layouts, giu.Label("Please select an image from the list."))
 		} else if len(currentJob.Images) > 0 {
@@ -237,17 +272,30 @@ func comparisonPane() giu.Widget {
 			giu.Label("Image Comparison"),
 			giu.Row(
 				giu.Button("Generate Morph").OnClick(func() {
-					if currentJob != nil && selectedImage > 0 {
-						pairIndex := selectedImage - 1
-						if len(currentJob.ImagePoints) > pairIndex && len(currentJob.ImagePoints[pairIndex]) > 0 {
-							giu.Msgbox("Info", fmt.Sprintf("Would morph with %d point pairs", len(currentJob.ImagePoints[pairIndex])))
-						} else {
-							giu.Msgbox("Info", "No point pairs available for morphing")
-						}
-					} else {
+					if currentJob == nil || selectedImage <= 0 {
 						giu.Msgbox("Info", "Select a non-zero image to enable morphing")
+						return
+					}
+					if err := startPreview(selectedImage - 1); err != nil {
+						giu.Msgbox("Error", fmt.Sprintf("Cannot generate morph: %v", err))
 					}
 				}),
+				giu.Button("Add Lattice").OnClick(func() {
+					if currentJob == nil || len(currentJob.Images) == 0 {
+						giu.Msgbox("Error", "Add some images before adding a lattice")
+						return
+					}
+					if err := addLatticeToAllImages(latticeSize, latticeSize); err != nil {
+						giu.Msgbox("Error", err.Error())
+					}
+				}),
+				giu.Button("Suggest Points").Disabled(suggesting()).OnClick(func() {
+					if currentJob == nil || len(currentJob.Images) < 2 {
+						giu.Msgbox("Error", "Add at least two images before suggesting points")
+						return
+					}
+					startSuggest()
+				}),
 				giu.Button("Save Project").OnClick(func() {
 					if currentJob != nil {
 						if saveFilePath == "" {
@@ -264,7 +312,14 @@ func comparisonPane() giu.Widget {
 					}
 				}),
 			),
-			giu.InputText(&saveFilePath).Hint("project.json").Label("Save as:"),
+			giu.Row(
+				giu.InputText(&saveFilePath).Hint("project.json").Label("Save as:"),
+				giu.Combo("Method", warpMethods[selectedMethod], warpMethods, &selectedMethod).Size(120).OnChange(func() {
+					if currentJob != nil {
+						currentJob.Method = warpMethods[selectedMethod]
+					}
+				}),
+			),
 			giu.Column(layouts...),
 		}.Build()
 	})
@@ -338,27 +393,68 @@ func addPointToAllImages(clickedPoint image.Point, clickedImageIndex int) {
 		currentJob.ImagePoints = append(currentJob.ImagePoints, [][]int{})
 	}
 
-	// Add a new point to each image at the same relative position
+	// Place the new point on each of the other images where the existing
+	// points predict it, before adding any so the predictions all see the
+	// same correspondences. Template matching refines them in the background.
+	newPoints := make([]image.Point, numImages)
+	var placements []placement
 	for i := 0; i < numImages; i++ {
-		var pointX, pointY int
-		if i == clickedImageIndex {
-			// Use the exact clicked position for the clicked image
-			pointX = clickedPoint.X
-			pointY = clickedPoint.Y
-		} else {
-			// For other images, use the same coordinates
-			// In a more sophisticated implementation, you might want to transform
-			// coordinates based on image differences, but for now use the same coords
-			pointX = clickedPoint.X
-			pointY = clickedPoint.Y
+		newPoints[i] = clickedPoint
+		if i != clickedImageIndex {
+			newPoints[i] = predictPoint(clickedPoint, clickedImageIndex, i)
+			placements = append(placements, placement{
+				key:       pointKey{i, len(currentJob.ImagePoints[i])},
+				predicted: newPoints[i],
+			})
 		}
-
+	}
+	for i, point := range newPoints {
 		// Add the point as [x, y] to this image
-		newPoint := []int{pointX, pointY}
-		currentJob.ImagePoints[i] = append(currentJob.ImagePoints[i], newPoint)
+		currentJob.ImagePoints[i] = append(currentJob.ImagePoints[i], []int{point.X, point.Y})
+	}
+	if len(placements) > 0 {
+		refinePlacements(clickedPoint, clickedImageIndex, placements)
 	}
 }
 
+// addLatticeToAllImages replaces the lattice on every image with an evenly
+// spaced rows x cols lattice
+func addLatticeToAllImages(rows, cols int) error {
+	currentJob.ImageLattices = nil
+	for _, path := range currentJob.Images {
+		_, size, err := loadImage(path)
+		if err != nil {
+			return err
+		}
+		lattice := warp.NewLattice(image.Rectangle{Max: size}, rows, cols)
+		saved := warp.LatticeSaveFormat{Rows: rows, Cols: cols}
+		for _, point := range lattice.Points {
+			saved.Points = append(saved.Points, []int{int(point.X), int(point.Y)})
+		}
+		currentJob.ImageLattices = append(currentJob.ImageLattices, saved)
+	}
+	return nil
+}
+
+// clampLatticeVertex limits pos so the vertex at index stays strictly
+// between its neighbours, so dragging can't fold the lattice
+func clampLatticeVertex(lattice warp.LatticeSaveFormat, index int, pos image.Point) image.Point {
+	row, col := index/lattice.Cols, index%lattice.Cols
+	if col > 0 {
+		pos.X = max(pos.X, lattice.Points[index-1][0]+1)
+	}
+	if col < lattice.Cols-1 {
+		pos.X = min(pos.X, lattice.Points[index+1][0]-1)
+	}
+	if row > 0 {
+		pos.Y = max(pos.Y, lattice.Points[index-lattice.Cols][1]+1)
+	}
+	if row < lattice.Rows-1 {
+		pos.Y = min(pos.Y, lattice.Points[index+lattice.Cols][1]-1)
+	}
+	return pos
+}
+
 func clickableImage(tex *giu.Texture, scaledSize image.Point, originalSize image.Point, imageIndex int) giu.Widget {
 	return giu.Custom(func() {
 		startPos := giu.GetCursorScreenPos()
@@ -429,6 +525,7 @@ func clickableImage(tex *giu.Texture, scaledSize image.Point, originalSize image
 								if distSq <= 10*10 {
 									// Start dragging this point
 									draggingPoint.isDragging = true
+									draggingPoint.isLattice = false
 									draggingPoint.imageIndex = imageIndex
 									draggingPoint.pointIndex = pointIdx
 									draggingPoint.dragStartPos = clickPos
@@ -437,6 +534,23 @@ func clickableImage(tex *giu.Texture, scaledSize image.Point, originalSize image
 							}
 						}
 					}
+					// Otherwise check for a nearby lattice vertex
+					if !draggingPoint.isDragging && currentJob != nil && len(currentJob.ImageLattices) > imageIndex {
+						for vertexIdx, vertex := range currentJob.ImageLattices[imageIndex].Points {
+							displayX := int(float32(vertex[0]) * scaleX)
+							displayY := int(float32(vertex[1]) * scaleY)
+							dx := clickPos.X - displayX
+							dy := clickPos.Y - displayY
+							if dx*dx+dy*dy <= 10*10 {
+								draggingPoint.isDragging = true
+								draggingPoint.isLattice = true
+								draggingPoint.imageIndex = imageIndex
+								draggingPoint.pointIndex = vertexIdx
+								draggingPoint.dragStartPos = clickPos
+								break
+							}
+						}
+					}
 
 					// Update click tracking for double-click detection
 					lastClickTime = float64(currentTime)
@@ -470,10 +584,20 @@ func clickableImage(tex *giu.Texture, scaledSize image.Point, originalSize image
 				}
 
 				// Update the point position
-				if currentJob != nil && len(currentJob.ImagePoints) > imageIndex &&
+				if draggingPoint.isLattice {
+					if currentJob != nil && len(currentJob.ImageLattices) > imageIndex &&
+						draggingPoint.pointIndex < len(currentJob.ImageLattices[imageIndex].Points) {
+						lattice := currentJob.ImageLattices[imageIndex]
+						pos := clampLatticeVertex(lattice, draggingPoint.pointIndex, image.Pt(originalX, originalY))
+						lattice.Points[draggingPoint.pointIndex][0] = pos.X
+						lattice.Points[draggingPoint.pointIndex][1] = pos.Y
+					}
+				} else if currentJob != nil && len(currentJob.ImagePoints) > imageIndex &&
 					draggingPoint.pointIndex < len(currentJob.ImagePoints[imageIndex]) {
 					currentJob.ImagePoints[imageIndex][draggingPoint.pointIndex][0] = originalX
 					currentJob.ImagePoints[imageIndex][draggingPoint.pointIndex][1] = originalY
+					// The user has placed it, so it no longer needs checking
+					delete(pointConfidence, pointKey{imageIndex, draggingPoint.pointIndex})
 				}
 			} else {
 				// Mouse released, stop dragging
@@ -481,6 +605,32 @@ func clickableImage(tex *giu.Texture, scaledSize image.Point, originalSize image
 			}
 		}
 
+		// Draw the lattice, if there is one
+		if currentJob != nil && len(currentJob.ImageLattices) > imageIndex {
+			lattice := currentJob.ImageLattices[imageIndex]
+			toDisplay := func(i int) image.Point {
+				return startPos.Add(image.Pt(int(float32(lattice.Points[i][0])*scaleX), int(float32(lattice.Points[i][1])*scaleY)))
+			}
+			lineColor := color.RGBA{R: 255, G: 255, B: 255, A: 160}
+			for i := range lattice.Points {
+				if i%lattice.Cols < lattice.Cols-1 {
+					canvas.AddLine(toDisplay(i), toDisplay(i+1), lineColor, 1)
+				}
+				if i+lattice.Cols < len(lattice.Points) {
+					canvas.AddLine(toDisplay(i), toDisplay(i+lattice.Cols), lineColor, 1)
+				}
+			}
+			for i := range lattice.Points {
+				pos := toDisplay(i)
+				vertexColor := color.RGBA{R: 255, G: 160, B: 0, A: 255}
+				size := 3
+				if draggingPoint.isDragging && draggingPoint.isLattice && draggingPoint.imageIndex == imageIndex && draggingPoint.pointIndex == i {
+					size = 5
+				}
+				canvas.AddRectFilled(pos.Sub(image.Pt(size, size)), pos.Add(image.Pt(size, size)), vertexColor, 0, 0)
+			}
+		}
+
 		// Draw existing points
 		if currentJob != nil && len(currentJob.ImagePoints) > imageIndex {
 			for i, pointPair := range currentJob.ImagePoints[imageIndex] {
@@ -504,13 +654,20 @@ func clickableImage(tex *giu.Texture, scaledSize image.Point, originalSize image
 					pointColor := colors[i%len(colors)]
 
 					// Highlight the point being dragged
-					if draggingPoint.isDragging && draggingPoint.imageIndex == imageIndex && draggingPoint.pointIndex == i {
+					if draggingPoint.isDragging && !draggingPoint.isLattice && draggingPoint.imageIndex == imageIndex && draggingPoint.pointIndex == i {
 						canvas.AddCircleFilled(drawPos, 6, pointColor)
 						canvas.AddCircle(drawPos, 8, color.RGBA{R: 255, G: 255, B: 255, A: 255}, 12, 2)
 					} else {
 						canvas.AddCircleFilled(drawPos, 4, pointColor)
 						canvas.AddCircle(drawPos, 6, color.RGBA{R: 255, G: 255, B: 255, A: 255}, 12, 1)
 					}
+
+					// Flag points which were placed by a poor template match
+					if lowConfidencePoint(imageIndex, i) {
+						warningColor := color.RGBA{R: 255, G: 140, B: 0, A: 255}
+						canvas.AddCircle(drawPos, 10, warningColor, 12, 2)
+						canvas.AddText(drawPos.Add(image.Pt(10, -18)), warningColor, "?")
+					}
 				}
 			}
 		}
@@ -540,6 +697,11 @@ func main() {
 		if len(currentJob.Images) > 0 {
 			selectedImage = 0
 		}
+		for i, method := range warpMethods {
+			if method == currentJob.Method {
+				selectedMethod = int32(i)
+			}
+		}
 	}
 
 	wnd := giu.NewMasterWindow("MorphLet", 1024, 768, 0)
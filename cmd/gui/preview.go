@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/AllenDang/giu"
+	"github.com/AndreRenaud/morphlet/warp"
+)
+
+// preview holds the state of the morph scrubber. Frames are rendered in the
+// background, and only turned into a texture on the UI thread.
+var preview struct {
+	mutex      sync.Mutex
+	job        *warp.WarpJob
+	transition int
+	t          float64
+	rendering  bool         // A frame is being rendered
+	stale      bool         // t changed while rendering, so render again
+	frame      *image.NRGBA // Rendered, but not yet uploaded as a texture
+	err        error
+
+	// Only used on the UI thread
+	sliderT float32
+	texture *giu.Texture
+	size    image.Point
+}
+
+// startPreview builds a job from the current project, and starts previewing
+// the morph from image transition to transition+1
+func startPreview(transition int) error {
+	data, err := json.Marshal(currentJob)
+	if err != nil {
+		return err
+	}
+	job, err := warp.NewJobFromJson(data)
+	if err != nil {
+		return err
+	}
+	if transition < 0 || transition >= len(job.Images)-1 {
+		return fmt.Errorf("select an image after the first to preview the morph into it")
+	}
+
+	preview.mutex.Lock()
+	preview.job = job
+	preview.transition = transition
+	preview.frame = nil
+	preview.err = nil
+	preview.mutex.Unlock()
+	preview.texture = nil
+	preview.sliderT = 0.5
+	renderPreview(float64(preview.sliderT))
+	return nil
+}
+
+// previewing reports whether the scrubber is open
+func previewing() bool {
+	preview.mutex.Lock()
+	defer preview.mutex.Unlock()
+	return preview.job != nil
+}
+
+// stopPreview closes the scrubber
+func stopPreview() {
+	preview.mutex.Lock()
+	defer preview.mutex.Unlock()
+	preview.job = nil
+	preview.frame = nil
+	preview.texture = nil
+}
+
+// renderPreview renders the preview at time t in the background. While a
+// render is in progress, only the latest request is kept, so dragging the
+// slider doesn't queue up frames.
+func renderPreview(t float64) {
+	preview.mutex.Lock()
+	defer preview.mutex.Unlock()
+	preview.t = t
+	if preview.rendering {
+		preview.stale = true
+		return
+	}
+	preview.rendering = true
+	job, transition := preview.job, preview.transition
+	go func() {
+		for {
+			frame, err := job.RenderFrame(transition, t)
+
+			preview.mutex.Lock()
+			if preview.job == job {
+				preview.frame, preview.err = frame, err
+			}
+			if !preview.stale || preview.job == nil {
+				preview.rendering = false
+				preview.mutex.Unlock()
+				break
+			}
+			// Pick up the latest request, which may be for a new job
+			preview.stale = false
+			job, transition, t = preview.job, preview.transition, preview.t
+			preview.mutex.Unlock()
+		}
+		giu.Update()
+	}()
+}
+
+// previewPane shows the latest rendered frame, with a slider to scrub
+// through the transition
+func previewPane() giu.Widget {
+	preview.mutex.Lock()
+	if preview.frame != nil {
+		preview.size = preview.frame.Bounds().Size()
+		giu.NewTextureFromRgba(preview.frame, func(tex *giu.Texture) {
+			preview.texture = tex
+		})
+		preview.frame = nil
+	}
+	transition, err := preview.transition, preview.err
+	preview.mutex.Unlock()
+
+	layouts := []giu.Widget{
+		giu.Row(
+			giu.Label(fmt.Sprintf("Morph %d to %d", transition, transition+1)),
+			giu.SliderFloat(&preview.sliderT, 0, 1).Format("t = %.3f").OnChange(func() {
+				renderPreview(float64(preview.sliderT))
+			}),
+			giu.Button("Close Preview").OnClick(stopPreview),
+		),
+	}
+	switch {
+	case err != nil:
+		layouts = append(layouts, giu.Label("Error rendering preview: "+err.Error()))
+	case preview.texture == nil:
+		layouts = append(layouts, giu.Label("Rendering..."))
+	default:
+		availW, availH := giu.GetAvailableRegion()
+		scaledSize := getScaledSize(preview.size, image.Pt(int(availW), int(availH)))
+		layouts = append(layouts, simpleImage(preview.texture, scaledSize))
+	}
+	return giu.Layout(layouts)
+}
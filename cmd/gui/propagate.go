@@ -0,0 +1,189 @@
+package main
+
+import (
+	"image"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/AllenDang/giu"
+	"github.com/AndreRenaud/morphlet/warp"
+	"github.com/fogleman/delaunay"
+)
+
+// lowConfidence is the template match confidence below which a propagated
+// point is flagged for the user to check
+const lowConfidence = 0.8
+
+// pointKey identifies a point on one image of the project. Points are only
+// ever added, so their indices are stable. Images are identified by index,
+// as a project may use the same image more than once, and the keys are
+// updated when images are reordered or removed.
+type pointKey struct {
+	image int
+	point int
+}
+
+// pointConfidence holds the confidence of propagated points which may be
+// misplaced. They stay flagged until the user drags them.
+var pointConfidence = make(map[pointKey]float64)
+
+// sourceImages holds decoded images for template matching, which is done in
+// the background
+var sourceImages struct {
+	mutex  sync.Mutex
+	images map[string]*image.NRGBA
+}
+
+func loadSourceImage(path string) (*image.NRGBA, error) {
+	sourceImages.mutex.Lock()
+	defer sourceImages.mutex.Unlock()
+	if img, ok := sourceImages.images[path]; ok {
+		return img, nil
+	}
+	img, err := warp.LoadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	if sourceImages.images == nil {
+		sourceImages.images = make(map[string]*image.NRGBA)
+	}
+	sourceImages.images[path] = img
+	return img, nil
+}
+
+// placement is a propagated point, placed at a predicted location until
+// template matching in the background refines it
+type placement struct {
+	key        pointKey
+	predicted  image.Point
+	matched    image.Point
+	confidence float64
+}
+
+// propagation holds the template matches finished in the background, until
+// they are applied to the project on the UI thread
+var propagation struct {
+	mutex   sync.Mutex
+	images  [][]string // Project images each batch of placements was made for
+	batches [][]placement
+}
+
+// predictPoint predicts where the point clicked on image from lies on image
+// to, from the existing correspondences between the two images
+func predictPoint(clicked image.Point, from, to int) image.Point {
+	p := warp.PredictPoint(jobPoints(from), jobPoints(to), delaunay.Point{X: float64(clicked.X), Y: float64(clicked.Y)})
+	return image.Pt(int(math.Round(p.X)), int(math.Round(p.Y)))
+}
+
+// refinePlacements template matches the patch around clicked on image from
+// against each placement's predicted location, in the background. A poor
+// match is likely to be further off than the prediction, so the prediction
+// is kept instead.
+func refinePlacements(clicked image.Point, from int, placements []placement) {
+	images := slices.Clone(currentJob.Images)
+	go func() {
+		src, srcErr := loadSourceImage(images[from])
+		for i := range placements {
+			p := &placements[i]
+			p.matched = p.predicted
+			if srcErr != nil {
+				continue
+			}
+			dst, err := loadSourceImage(images[p.key.image])
+			if err != nil {
+				continue
+			}
+			b := dst.Bounds()
+			p.matched = image.Pt(max(0, min(p.predicted.X, b.Dx()-1)), max(0, min(p.predicted.Y, b.Dy()-1)))
+			match := warp.MatchTemplate(src, clicked, dst, p.matched, warp.TemplateOptions{})
+			p.confidence = match.Confidence
+			if match.Confidence >= lowConfidence {
+				p.matched = match.Point
+			}
+		}
+
+		propagation.mutex.Lock()
+		propagation.images = append(propagation.images, images)
+		propagation.batches = append(propagation.batches, placements)
+		propagation.mutex.Unlock()
+		giu.Update()
+	}()
+}
+
+// applyPropagation moves points to their finished template matches, unless
+// the images have changed or the user has moved the point in the meantime
+func applyPropagation() {
+	propagation.mutex.Lock()
+	images, batches := propagation.images, propagation.batches
+	propagation.images, propagation.batches = nil, nil
+	propagation.mutex.Unlock()
+
+	for b, placements := range batches {
+		if currentJob == nil || !slices.Equal(images[b], currentJob.Images) {
+			continue
+		}
+		for _, p := range placements {
+			if p.key.image >= len(currentJob.ImagePoints) || p.key.point >= len(currentJob.ImagePoints[p.key.image]) {
+				continue
+			}
+			point := currentJob.ImagePoints[p.key.image][p.key.point]
+			if point[0] != p.predicted.X || point[1] != p.predicted.Y {
+				continue
+			}
+			point[0], point[1] = p.matched.X, p.matched.Y
+			if p.confidence < lowConfidence {
+				pointConfidence[p.key] = p.confidence
+			}
+		}
+	}
+}
+
+// jobPoints returns the points of image i of the project
+func jobPoints(i int) []delaunay.Point {
+	var points []delaunay.Point
+	if i < len(currentJob.ImagePoints) {
+		for _, point := range currentJob.ImagePoints[i] {
+			points = append(points, delaunay.Point{X: float64(point[0]), Y: float64(point[1])})
+		}
+	}
+	return points
+}
+
+// lowConfidencePoint reports whether point pointIndex of image imageIndex was
+// propagated by a poor match
+func lowConfidencePoint(imageIndex, pointIndex int) bool {
+	confidence, ok := pointConfidence[pointKey{imageIndex, pointIndex}]
+	return ok && confidence < lowConfidence
+}
+
+// swapPointFlags swaps the flags of images a and b, as they are reordered
+func swapPointFlags(a, b int) {
+	swapped := make(map[pointKey]float64, len(pointConfidence))
+	for key, confidence := range pointConfidence {
+		switch key.image {
+		case a:
+			key.image = b
+		case b:
+			key.image = a
+		}
+		swapped[key] = confidence
+	}
+	pointConfidence = swapped
+}
+
+// removePointFlags drops the flags of image i, and renumbers those of the
+// images after it, as it is removed
+func removePointFlags(i int) {
+	remaining := make(map[pointKey]float64, len(pointConfidence))
+	for key, confidence := range pointConfidence {
+		if key.image == i {
+			continue
+		}
+		if key.image > i {
+			key.image--
+		}
+		remaining[key] = confidence
+	}
+	pointConfidence = remaining
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"sync"
+
+	"github.com/AllenDang/giu"
+	"github.com/AndreRenaud/morphlet/warp"
+	"github.com/fogleman/delaunay"
+)
+
+// suggestion holds the state of the "Suggest Points" feature matching, which
+// runs in the background. Its result is only added to the project on the UI
+// thread.
+var suggestion struct {
+	mutex   sync.Mutex
+	running bool
+	images  []string           // Images the points were matched across
+	points  [][]delaunay.Point // Matched, but not yet added to the project
+	err     error
+}
+
+// startSuggest starts matching features across the project's images
+func startSuggest() {
+	suggestion.mutex.Lock()
+	defer suggestion.mutex.Unlock()
+	if suggestion.running {
+		return
+	}
+	suggestion.running = true
+	images := slices.Clone(currentJob.Images)
+	go func() {
+		points, err := suggestPoints(images)
+
+		suggestion.mutex.Lock()
+		suggestion.running = false
+		suggestion.images, suggestion.points, suggestion.err = images, points, err
+		suggestion.mutex.Unlock()
+		giu.Update()
+	}()
+}
+
+func suggestPoints(filenames []string) ([][]delaunay.Point, error) {
+	images := make([]*image.NRGBA, len(filenames))
+	for i, filename := range filenames {
+		img, err := warp.LoadImage(filename)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = img
+	}
+	return warp.SuggestImagePoints(images, warp.FeatureOptions{})
+}
+
+// suggesting reports whether features are being matched
+func suggesting() bool {
+	suggestion.mutex.Lock()
+	defer suggestion.mutex.Unlock()
+	return suggestion.running
+}
+
+// applySuggestion adds the points from a finished match to the project,
+// unless its images have changed in the meantime
+func applySuggestion() {
+	suggestion.mutex.Lock()
+	images, points, err := suggestion.images, suggestion.points, suggestion.err
+	suggestion.images, suggestion.points, suggestion.err = nil, nil, nil
+	suggestion.mutex.Unlock()
+
+	switch {
+	case err != nil:
+		giu.Msgbox("Error", fmt.Sprintf("Cannot suggest points: %v", err))
+	case points == nil:
+	case currentJob == nil || !slices.Equal(images, currentJob.Images):
+		giu.Msgbox("Info", "The images changed while matching, so no points were added")
+	default:
+		added, err := currentJob.AddImagePoints(points)
+		if err != nil {
+			giu.Msgbox("Error", fmt.Sprintf("Cannot add suggested points: %v", err))
+		} else {
+			giu.Msgbox("Success", fmt.Sprintf("Added %d points", added))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package warp
+
+import (
+	"image"
+	"math"
+)
+
+// BlendMode selects the colour space the cross-dissolve is performed in
+type BlendMode int
+
+const (
+	// BlendSRGB mixes the sRGB encoded values directly. This is cheaper, but
+	// mid-transition frames come out darker than either endpoint.
+	BlendSRGB BlendMode = iota
+	// BlendLinear converts to linear light, mixes there, and re-encodes to sRGB
+	BlendLinear
+)
+
+// linearLevels is the resolution of the linear light -> sRGB lookup table.
+// 8 bit linear values would band badly in the shadows, so use 12 bits.
+const linearLevels = 4096
+
+var (
+	srgbToLinearTable [256]float32
+	linearToSRGBTable [linearLevels]uint8
+)
+
+func init() {
+	for i := range srgbToLinearTable {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			v = v / 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		srgbToLinearTable[i] = float32(v)
+	}
+	for i := range linearToSRGBTable {
+		v := float64(i) / (linearLevels - 1)
+		if v <= 0.0031308 {
+			v = v * 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		linearToSRGBTable[i] = clampChannel(v * 255)
+	}
+}
+
+// linearToSRGB encodes a linear light value (0.0 - 1.0) to 8 bit sRGB
+func linearToSRGB(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return linearToSRGBTable[int(v*(linearLevels-1)+0.5)]
+}
+
+// maskedProgress offsets the dissolve progress t for a pixel by its mask
+// value m (0.0 - 1.0), so white pixels run from t=0 to 0.5 and black
+// pixels from t=0.5 to 1
+func maskedProgress(t, m float64) float64 {
+	return math.Max(0, math.Min(1, 2*t-1+m))
+}
+
+// crossDissolve blends from and to, weighting to by t (0.0 - 1.0). The
+// source alpha of both images is preserved, and the mix is done on
+// premultiplied colours so transparent edges don't pick up dark fringes. If
+// mask is non-nil, its luminance varies t per pixel (see Transition.Mask).
+func crossDissolve(from, to *image.NRGBA, t float64, mode BlendMode, mask *image.NRGBA) *image.NRGBA {
+	combined := image.NewNRGBA(to.Bounds())
+	b := combined.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			f := from.Pix[from.PixOffset(x, y):]
+			o := to.Pix[to.PixOffset(x, y):]
+			c := combined.Pix[combined.PixOffset(x, y):]
+
+			t := t
+			if mask != nil {
+				m := mask.Pix[mask.PixOffset(x, y):]
+				luma := (299*float64(m[0]) + 587*float64(m[1]) + 114*float64(m[2])) / (1000 * 255)
+				t = maskedProgress(t, luma)
+			}
+
+			fa := float64(f[3]) * (1 - t)
+			oa := float64(o[3]) * t
+			a := fa + oa
+			if a == 0 {
+				continue
+			}
+			for i := 0; i < 3; i++ {
+				if mode == BlendLinear {
+					v := float64(srgbToLinearTable[f[i]])*fa + float64(srgbToLinearTable[o[i]])*oa
+					c[i] = linearToSRGB(v / a)
+				} else {
+					c[i] = clampChannel((float64(f[i])*fa + float64(o[i])*oa) / a)
+				}
+			}
+			c[3] = clampChannel(a)
+		}
+	}
+	return combined
+}
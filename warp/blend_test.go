@@ -0,0 +1,105 @@
+package warp
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCrossDissolvePreservesAlpha(t *testing.T) {
+	from := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	to := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	// A transparent pixel fading into opaque red must stay red, not darken
+	from.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 0})
+	to.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	// Fully transparent in both stays transparent
+	from.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 0})
+	to.SetNRGBA(1, 0, color.NRGBA{0, 0, 255, 0})
+
+	combined := crossDissolve(from, to, 0.5, BlendSRGB, nil)
+	if got, want := combined.NRGBAAt(0, 0), (color.NRGBA{255, 0, 0, 128}); got != want {
+		t.Errorf("pixel 0 = %v, want %v", got, want)
+	}
+	if got := combined.NRGBAAt(1, 0).A; got != 0 {
+		t.Errorf("pixel 1 alpha = %d, want 0", got)
+	}
+}
+
+func TestCrossDissolveLinear(t *testing.T) {
+	from := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	to := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	from.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	to.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
+
+	// Half way between black and white is 50% linear light, which is ~188 in sRGB
+	if got := crossDissolve(from, to, 0.5, BlendLinear, nil).NRGBAAt(0, 0).R; got < 186 || got > 189 {
+		t.Errorf("linear blend = %d, want ~188", got)
+	}
+	if got := crossDissolve(from, to, 0.5, BlendSRGB, nil).NRGBAAt(0, 0).R; got != 128 {
+		t.Errorf("sRGB blend = %d, want 128", got)
+	}
+}
+
+func TestCrossDissolveMask(t *testing.T) {
+	from := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	to := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	mask := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	for x := 0; x < 2; x++ {
+		from.SetNRGBA(x, 0, color.NRGBA{0, 0, 0, 255})
+		to.SetNRGBA(x, 0, color.NRGBA{200, 200, 200, 255})
+	}
+	// White dissolves first, black last
+	mask.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
+	mask.SetNRGBA(1, 0, color.NRGBA{0, 0, 0, 255})
+
+	combined := crossDissolve(from, to, 0.5, BlendSRGB, mask)
+	if got := combined.NRGBAAt(0, 0).R; got != 200 {
+		t.Errorf("white mask pixel = %d, want 200", got)
+	}
+	if got := combined.NRGBAAt(1, 0).R; got != 0 {
+		t.Errorf("black mask pixel = %d, want 0", got)
+	}
+}
+
+func TestMorphFramesOpaqueToTheEdge(t *testing.T) {
+	// Opaque images must give opaque frames, including the outermost pixels
+	for _, antiAlias := range []bool{false, true} {
+		job := pairJob(MethodTriangles)
+		job.AntiAlias = antiAlias
+		for _, tt := range []float64{0, 0.3, 1} {
+			frame, err := job.RenderFrame(0, tt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 3; i < len(frame.Pix); i += 4 {
+				if frame.Pix[i] != 255 {
+					x, y := (i/4)%frame.Rect.Dx(), (i/4)/frame.Rect.Dx()
+					t.Fatalf("antialias %v, t=%g: pixel (%d,%d) has alpha %d, want 255", antiAlias, tt, x, y, frame.Pix[i])
+				}
+			}
+		}
+	}
+
+	// A white mask dissolves everywhere by the middle of the transition, so
+	// the warped mask must not leave the edges behind
+	job := pairJob(MethodTriangles)
+	mask := image.NewNRGBA(job.Images[0].Rect)
+	for i := range mask.Pix {
+		mask.Pix[i] = 255
+	}
+	job.Transitions = []Transition{{Mask: mask}}
+	frame, err := job.RenderFrame(0, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The geometry is only half way, so compare against the other image
+	// warped into it
+	to, err := job.warpTo(context.Background(), job.Images[1], 1, 0, 0.5, job.cache.triangles[0].triangles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := imageDifference(frame, to, 1); n > 0 {
+		t.Errorf("white mask: %d pixels haven't fully dissolved", n)
+	}
+}
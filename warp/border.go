@@ -0,0 +1,94 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// BorderMode selects what samplers read for pixels outside the source image
+type BorderMode int
+
+const (
+	// BorderClamp repeats the nearest edge pixel
+	BorderClamp BorderMode = iota
+	// BorderTransparent treats everything outside the image as transparent,
+	// for compositing the result over other footage
+	BorderTransparent
+	// BorderMirror reflects the image back on itself at each edge
+	BorderMirror
+	// BorderWrap tiles the image
+	BorderWrap
+	// BorderConstant fills outside the image with Border.Color
+	BorderConstant
+)
+
+// Border describes how to sample outside the source image. The zero value
+// clamps to the edge pixels.
+type Border struct {
+	Mode  BorderMode
+	Color color.NRGBA // Only used by BorderConstant
+}
+
+// BorderModeByName looks up a border mode from its command line/json name
+func BorderModeByName(name string) (BorderMode, error) {
+	switch name {
+	case "", "clamp":
+		return BorderClamp, nil
+	case "transparent":
+		return BorderTransparent, nil
+	case "mirror":
+		return BorderMirror, nil
+	case "wrap":
+		return BorderWrap, nil
+	case "constant":
+		return BorderConstant, nil
+	default:
+		return 0, fmt.Errorf("unknown border mode: %q", name)
+	}
+}
+
+// pixel returns the pixel at (x,y) in img, applying the border mode to
+// coordinates outside it
+func (b Border) pixel(img *image.NRGBA, x, y int) color.NRGBA {
+	r := img.Bounds()
+	if !(image.Point{x, y}).In(r) {
+		switch b.Mode {
+		case BorderTransparent:
+			return color.NRGBA{}
+		case BorderConstant:
+			return b.Color
+		case BorderMirror:
+			x = r.Min.X + mirror(x-r.Min.X, r.Dx())
+			y = r.Min.Y + mirror(y-r.Min.Y, r.Dy())
+		case BorderWrap:
+			x = r.Min.X + wrap(x-r.Min.X, r.Dx())
+			y = r.Min.Y + wrap(y-r.Min.Y, r.Dy())
+		default:
+			x = max(r.Min.X, min(x, r.Max.X-1))
+			y = max(r.Min.Y, min(y, r.Max.Y-1))
+		}
+	}
+	i := img.PixOffset(x, y)
+	p := img.Pix[i : i+4 : i+4]
+	return color.NRGBA{p[0], p[1], p[2], p[3]}
+}
+
+// wrap returns v modulo size, in the range 0 to size-1
+func wrap(v, size int) int {
+	v %= size
+	if v < 0 {
+		v += size
+	}
+	return v
+}
+
+// mirror reflects v into the range 0 to size-1, repeating the edge pixels so
+// that -1 maps to 0 and size maps to size-1
+func mirror(v, size int) int {
+	v = wrap(v, 2*size)
+	if v >= size {
+		v = 2*size - 1 - v
+	}
+	return v
+}
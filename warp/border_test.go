@@ -0,0 +1,53 @@
+package warp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBorderPixel(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	for x := 0; x < 3; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{uint8(x * 100), 0, 0, 255})
+	}
+	red := color.NRGBA{255, 0, 0, 255}
+	tests := []struct {
+		border Border
+		x      int
+		want   uint8 // Red channel
+		alpha  uint8
+	}{
+		{Border{}, -2, 0, 255},
+		{Border{}, 5, 200, 255},
+		{Border{Mode: BorderTransparent}, -1, 0, 0},
+		{Border{Mode: BorderConstant, Color: red}, 3, 255, 255},
+		{Border{Mode: BorderMirror}, -1, 0, 255},
+		{Border{Mode: BorderMirror}, -2, 100, 255},
+		{Border{Mode: BorderMirror}, 3, 200, 255},
+		{Border{Mode: BorderMirror}, 4, 100, 255},
+		{Border{Mode: BorderWrap}, -1, 200, 255},
+		{Border{Mode: BorderWrap}, 4, 100, 255},
+		{Border{Mode: BorderWrap}, 1, 100, 255},
+	}
+	for _, test := range tests {
+		c := test.border.pixel(img, test.x, 0)
+		if c.R != test.want || c.A != test.alpha {
+			t.Errorf("mode %d at x=%d: got %v, want R=%d A=%d", test.border.Mode, test.x, c, test.want, test.alpha)
+		}
+	}
+}
+
+func TestTransparentBorderFadesEdge(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	c := BilinearSampler{}.Sample(img, -0.5, 1, Border{Mode: BorderTransparent})
+	if c.A < 120 || c.A > 135 {
+		t.Errorf("alpha half a pixel outside the edge = %d, want ~128", c.A)
+	}
+	if c.R != 255 {
+		t.Errorf("colour bled from the transparent border: %v", c)
+	}
+}
@@ -0,0 +1,130 @@
+package warp
+
+import (
+	"image"
+	"math"
+
+	"github.com/fogleman/delaunay"
+)
+
+// coverageGrid is the number of subsamples per axis used to estimate how much
+// of an edge pixel a triangle covers
+const coverageGrid = 4
+
+// coverageBuffer accumulates coverage weighted, premultiplied colour from
+// every triangle that touches a pixel. Triangles sharing an edge each add
+// their share of the pixel, so once resolved there are no seams between them.
+type coverageBuffer struct {
+	rect   image.Rectangle
+	pix    []float32 // Premultiplied R, G, B, A per pixel
+	weight []float32
+}
+
+func newCoverageBuffer(rect image.Rectangle) *coverageBuffer {
+	return &coverageBuffer{
+		rect:   rect,
+		pix:    make([]float32, rect.Dx()*rect.Dy()*4),
+		weight: make([]float32, rect.Dx()*rect.Dy()),
+	}
+}
+
+// accumulateTriangle is the coverage based equivalent of warpTriangle. Every
+// pixel D touches is sampled once at its centre, weighted by the fraction of
+// it that is covered, which is supersampled on the edges of D.
+func (c *coverageBuffer) accumulateTriangle(src *image.NRGBA, S [3]delaunay.Point, D [3]delaunay.Point, opts WarpOptions) {
+	P := [2][2]float64{
+		{S[1].X - S[0].X, S[2].X - S[0].X},
+		{S[1].Y - S[0].Y, S[2].Y - S[0].Y},
+	}
+	Q := [2][2]float64{
+		{D[1].X - D[0].X, D[2].X - D[0].X},
+		{D[1].Y - D[0].Y, D[2].Y - D[0].Y},
+	}
+
+	Qinv, ok := inv2x2(Q)
+	if !ok {
+		return // Degenerate destination triangle; nothing to do.
+	}
+
+	// Unlike warpTriangle, include any pixel the triangle touches at all
+	minX := max(c.rect.Min.X, int(math.Floor(math.Min(D[0].X, math.Min(D[1].X, D[2].X)))))
+	maxX := min(c.rect.Max.X, int(math.Floor(math.Max(D[0].X, math.Max(D[1].X, D[2].X))))+1)
+	minY := max(c.rect.Min.Y, int(math.Floor(math.Min(D[0].Y, math.Min(D[1].Y, D[2].Y)))))
+	maxY := min(c.rect.Max.Y, int(math.Floor(math.Max(D[0].Y, math.Max(D[1].Y, D[2].Y))))+1)
+
+	inside := func(x, y float64) bool {
+		uv := mul2(Qinv, sub(delaunay.Point{X: x, Y: y}, D[0]))
+		return uv.X >= 0 && uv.Y >= 0 && uv.X+uv.Y <= 1
+	}
+	sampler := opts.sampler()
+
+	for y := minY; y < maxY; y++ {
+		for x := minX; x < maxX; x++ {
+			fx, fy := float64(x), float64(y)
+			var coverage float64
+
+			// The triangle is convex, so if it contains all four corners it
+			// contains the whole pixel
+			if inside(fx, fy) && inside(fx+1, fy) && inside(fx, fy+1) && inside(fx+1, fy+1) {
+				coverage = 1
+			} else {
+				hits := 0
+				for j := 0; j < coverageGrid; j++ {
+					for i := 0; i < coverageGrid; i++ {
+						if inside(fx+(float64(i)+0.5)/coverageGrid, fy+(float64(j)+0.5)/coverageGrid) {
+							hits++
+						}
+					}
+				}
+				if hits == 0 {
+					continue
+				}
+				coverage = float64(hits) / (coverageGrid * coverageGrid)
+			}
+
+			// Sample at the pixel centre, extending the triangle's mapping past
+			// its edge if need be. Every triangle touching the pixel then reads
+			// the same point where their mappings agree, so an identity warp
+			// reproduces the source exactly.
+			p := delaunay.Point{X: fx + 0.5, Y: fy + 0.5}
+			uv := mul2(Qinv, sub(p, D[0]))
+			s := add(S[0], mul2(P, uv))
+			col := sampler.Sample(src, s.X, s.Y, opts.Border)
+
+			idx := (y-c.rect.Min.Y)*c.rect.Dx() + (x - c.rect.Min.X)
+			w := float32(coverage)
+			a := w * float32(col.A) / 255
+			c.pix[idx*4+0] += a * float32(col.R)
+			c.pix[idx*4+1] += a * float32(col.G)
+			c.pix[idx*4+2] += a * float32(col.B)
+			c.pix[idx*4+3] += a * 255
+			c.weight[idx] += w
+		}
+	}
+}
+
+// resolve normalises the accumulated colours by their total coverage and
+// writes them into dst. Pixels no triangle touched are left unchanged.
+func (c *coverageBuffer) resolve(dst *image.NRGBA) {
+	for y := c.rect.Min.Y; y < c.rect.Max.Y; y++ {
+		for x := c.rect.Min.X; x < c.rect.Max.X; x++ {
+			idx := (y-c.rect.Min.Y)*c.rect.Dx() + (x - c.rect.Min.X)
+			w := c.weight[idx]
+			if w == 0 {
+				continue
+			}
+			a := c.pix[idx*4+3] / w
+			o := dst.PixOffset(x, y)
+			if a == 0 {
+				dst.Pix[o+0], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = 0, 0, 0, 0
+				continue
+			}
+			// Undo the premultiplication: (sum/w) / (a/255)
+			scale := 255 / (a * w)
+			dst.Pix[o+0] = clampChannel(float64(c.pix[idx*4+0] * scale))
+			dst.Pix[o+1] = clampChannel(float64(c.pix[idx*4+1] * scale))
+			dst.Pix[o+2] = clampChannel(float64(c.pix[idx*4+2] * scale))
+			dst.Pix[o+3] = clampChannel(float64(a))
+		}
+	}
+}
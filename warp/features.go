@@ -0,0 +1,520 @@
+package warp
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/fogleman/delaunay"
+)
+
+// Feature is a corner detected in an image, with an oriented BRIEF
+// descriptor of the patch around it (as used by ORB)
+type Feature struct {
+	X, Y       float64
+	Score      float64 // Harris corner response
+	Angle      float64 // Patch orientation in radians
+	Descriptor [4]uint64
+}
+
+// Match pairs feature A of one image with feature B of another
+type Match struct {
+	A, B     int
+	Distance int // Hamming distance between the descriptors (0 - 256)
+}
+
+// FeatureOptions tunes the detection and matching used by SuggestImagePoints.
+// The zero value gives the defaults.
+type FeatureOptions struct {
+	MaxFeatures int     // Corners detected per image. If 0, uses 500
+	Ratio       float64 // Lowe's ratio test: the best match must be closer than Ratio times the second best. If 0, uses 0.8
+	// Threshold is the distance, as a fraction of the image diagonal, that a
+	// match may stray from the RANSAC fitted affine transform and still be
+	// kept. Morphs are between different subjects, so it is loose; it only
+	// rejects matches to unrelated parts of the image. If 0, uses 0.1.
+	Threshold float64
+	MaxPoints int // Correspondences to propose. If 0, uses 40
+}
+
+const (
+	patchRadius   = 15 // Radius of the patch described by a Feature
+	featureMargin = 22 // Features are kept this far from the edges, so rotated patches stay inside
+)
+
+func (o FeatureOptions) maxFeatures() int {
+	if o.MaxFeatures <= 0 {
+		return 500
+	}
+	return o.MaxFeatures
+}
+
+func (o FeatureOptions) ratio() float64 {
+	if o.Ratio <= 0 {
+		return 0.8
+	}
+	return o.Ratio
+}
+
+func (o FeatureOptions) threshold() float64 {
+	if o.Threshold <= 0 {
+		return 0.1
+	}
+	return o.Threshold
+}
+
+func (o FeatureOptions) maxPoints() int {
+	if o.MaxPoints <= 0 {
+		return 40
+	}
+	return o.MaxPoints
+}
+
+// grayImage is a single channel floating point image
+type grayImage struct {
+	w, h int
+	pix  []float32
+}
+
+func (g *grayImage) at(x, y int) float32 {
+	x = max(0, min(x, g.w-1))
+	y = max(0, min(y, g.h-1))
+	return g.pix[y*g.w+x]
+}
+
+// newGrayImage converts img to luminance (0.0 - 1.0), treating transparent
+// pixels as black
+func newGrayImage(img *image.NRGBA) *grayImage {
+	b := img.Bounds()
+	g := &grayImage{w: b.Dx(), h: b.Dy(), pix: make([]float32, b.Dx()*b.Dy())}
+	for y := 0; y < g.h; y++ {
+		p := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < g.w; x++ {
+			r, gr, bl, a := float32(p[4*x]), float32(p[4*x+1]), float32(p[4*x+2]), float32(p[4*x+3])
+			g.pix[y*g.w+x] = (0.299*r + 0.587*gr + 0.114*bl) * a / (255 * 255)
+		}
+	}
+	return g
+}
+
+// blur returns g convolved with a Gaussian of the given sigma
+func (g *grayImage) blur(sigma float64) *grayImage {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float32, 2*radius+1)
+	var total float32
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = float32(math.Exp(-d * d / (2 * sigma * sigma)))
+		total += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= total
+	}
+
+	tmp := &grayImage{w: g.w, h: g.h, pix: make([]float32, len(g.pix))}
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			var sum float32
+			for i, k := range kernel {
+				sum += k * g.at(x+i-radius, y)
+			}
+			tmp.pix[y*g.w+x] = sum
+		}
+	}
+	out := &grayImage{w: g.w, h: g.h, pix: make([]float32, len(g.pix))}
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			var sum float32
+			for i, k := range kernel {
+				sum += k * tmp.at(x, y+i-radius)
+			}
+			out.pix[y*g.w+x] = sum
+		}
+	}
+	return out
+}
+
+// harris returns the Harris corner response of every pixel of g
+func harris(g *grayImage) *grayImage {
+	xx := &grayImage{w: g.w, h: g.h, pix: make([]float32, len(g.pix))}
+	yy := &grayImage{w: g.w, h: g.h, pix: make([]float32, len(g.pix))}
+	xy := &grayImage{w: g.w, h: g.h, pix: make([]float32, len(g.pix))}
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			// Sobel gradients
+			dx := g.at(x+1, y-1) + 2*g.at(x+1, y) + g.at(x+1, y+1) - g.at(x-1, y-1) - 2*g.at(x-1, y) - g.at(x-1, y+1)
+			dy := g.at(x-1, y+1) + 2*g.at(x, y+1) + g.at(x+1, y+1) - g.at(x-1, y-1) - 2*g.at(x, y-1) - g.at(x+1, y-1)
+			i := y*g.w + x
+			xx.pix[i], yy.pix[i], xy.pix[i] = dx*dx, dy*dy, dx*dy
+		}
+	}
+	xx, yy, xy = xx.blur(1.5), yy.blur(1.5), xy.blur(1.5)
+
+	const k = 0.04
+	response := &grayImage{w: g.w, h: g.h, pix: make([]float32, len(g.pix))}
+	for i := range response.pix {
+		det := xx.pix[i]*yy.pix[i] - xy.pix[i]*xy.pix[i]
+		trace := xx.pix[i] + yy.pix[i]
+		response.pix[i] = det - k*trace*trace
+	}
+	return response
+}
+
+// briefPairs are the point pairs compared by the descriptor, drawn from an
+// isotropic Gaussian around the patch centre. They are fixed, so descriptors
+// from different images can be compared.
+var briefPairs = sync.OnceValue(func() [256][4]float64 {
+	rng := rand.New(rand.NewPCG(0x6d6f7270, 0x686c6574))
+	coord := func() float64 {
+		return math.Max(-patchRadius, math.Min(patchRadius, rng.NormFloat64()*patchRadius*2/5))
+	}
+	var pairs [256][4]float64
+	for i := range pairs {
+		pairs[i] = [4]float64{coord(), coord(), coord(), coord()}
+	}
+	return pairs
+})
+
+// DetectFeatures finds up to maxFeatures of the strongest Harris corners in
+// img, spread out so they don't cluster on a single textured region, and
+// describes each with a rotation invariant binary descriptor
+func DetectFeatures(img *image.NRGBA, maxFeatures int) []Feature {
+	gray := newGrayImage(img)
+	if gray.w <= 2*featureMargin || gray.h <= 2*featureMargin {
+		return nil
+	}
+	response := harris(gray)
+
+	// Local maxima over a 5x5 neighbourhood, above a fraction of the strongest
+	var strongest float32
+	for _, r := range response.pix {
+		strongest = max(strongest, r)
+	}
+	var candidates []Feature
+	for y := featureMargin; y < gray.h-featureMargin; y++ {
+		for x := featureMargin; x < gray.w-featureMargin; x++ {
+			r := response.pix[y*gray.w+x]
+			if r <= strongest*0.001 {
+				continue
+			}
+			isMax := true
+			for dy := -2; dy <= 2 && isMax; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					if (dx != 0 || dy != 0) && response.at(x+dx, y+dy) >= r {
+						isMax = false
+						break
+					}
+				}
+			}
+			if isMax {
+				candidates = append(candidates, Feature{X: float64(x), Y: float64(y), Score: float64(r)})
+			}
+		}
+	}
+	slices.SortFunc(candidates, func(a, b Feature) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	// Take the strongest first, skipping any too close to one already taken
+	minDist := math.Hypot(float64(gray.w), float64(gray.h)) / 100
+	var features []Feature
+	for _, c := range candidates {
+		if len(features) >= maxFeatures {
+			break
+		}
+		crowded := false
+		for _, f := range features {
+			if math.Hypot(f.X-c.X, f.Y-c.Y) < minDist {
+				crowded = true
+				break
+			}
+		}
+		if !crowded {
+			features = append(features, c)
+		}
+	}
+
+	smooth := gray.blur(2)
+	for i := range features {
+		describe(smooth, &features[i])
+	}
+	return features
+}
+
+// describe sets the orientation of f from the intensity centroid of its patch,
+// and its descriptor from brightness comparisons steered by that orientation
+func describe(smooth *grayImage, f *Feature) {
+	cx, cy := int(f.X), int(f.Y)
+	var m10, m01 float64
+	for dy := -patchRadius; dy <= patchRadius; dy++ {
+		for dx := -patchRadius; dx <= patchRadius; dx++ {
+			if dx*dx+dy*dy > patchRadius*patchRadius {
+				continue
+			}
+			v := float64(smooth.at(cx+dx, cy+dy))
+			m10 += float64(dx) * v
+			m01 += float64(dy) * v
+		}
+	}
+	f.Angle = math.Atan2(m01, m10)
+
+	sin, cos := math.Sincos(f.Angle)
+	rotated := func(x, y float64) float32 {
+		return smooth.at(cx+int(math.Round(x*cos-y*sin)), cy+int(math.Round(x*sin+y*cos)))
+	}
+	for i, p := range briefPairs() {
+		if rotated(p[0], p[1]) < rotated(p[2], p[3]) {
+			f.Descriptor[i/64] |= 1 << (i % 64)
+		}
+	}
+}
+
+func hamming(a, b [4]uint64) int {
+	return bits.OnesCount64(a[0]^b[0]) + bits.OnesCount64(a[1]^b[1]) + bits.OnesCount64(a[2]^b[2]) + bits.OnesCount64(a[3]^b[3])
+}
+
+// MatchFeatures pairs each feature of a with its nearest neighbour in b by
+// descriptor distance. A match is only kept if it passes Lowe's ratio test
+// (the best is clearly better than the second best), and the features are
+// each other's nearest neighbour.
+func MatchFeatures(a, b []Feature, ratio float64) []Match {
+	nearest := func(f Feature, others []Feature) (best, bestDist, secondDist int) {
+		best, bestDist, secondDist = -1, math.MaxInt, math.MaxInt
+		for i, o := range others {
+			d := hamming(f.Descriptor, o.Descriptor)
+			if d < bestDist {
+				best, bestDist, secondDist = i, d, bestDist
+			} else if d < secondDist {
+				secondDist = d
+			}
+		}
+		return best, bestDist, secondDist
+	}
+
+	var matches []Match
+	for i, f := range a {
+		j, d, second := nearest(f, b)
+		if j < 0 || (second != math.MaxInt && float64(d) >= ratio*float64(second)) {
+			continue
+		}
+		if back, _, _ := nearest(b[j], a); back != i {
+			continue
+		}
+		matches = append(matches, Match{A: i, B: j, Distance: d})
+	}
+	return matches
+}
+
+// ransacAffine keeps the matches consistent with a single affine transform
+// from a to b, to within threshold pixels, using RANSAC to find the transform
+// despite the outliers. Any three matches fit an affine transform exactly, so
+// unless at least one more agrees with them none are kept.
+func ransacAffine(a, b []Feature, matches []Match, threshold float64) []Match {
+	if len(matches) <= 3 {
+		return nil
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	var best []Match
+	for iter := 0; iter < 1000; iter++ {
+		i, j, k := rng.IntN(len(matches)), rng.IntN(len(matches)), rng.IntN(len(matches))
+		if i == j || j == k || i == k {
+			continue
+		}
+		model, ok := fitAffine(a, b, []Match{matches[i], matches[j], matches[k]})
+		if !ok {
+			continue
+		}
+		var inliers []Match
+		for _, m := range matches {
+			x, y := model.apply(a[m.A].X, a[m.A].Y)
+			if math.Hypot(x-b[m.B].X, y-b[m.B].Y) < threshold {
+				inliers = append(inliers, m)
+			}
+		}
+		if len(inliers) > len(best) {
+			best = inliers
+		}
+	}
+	if len(best) <= 3 {
+		return nil
+	}
+	return best
+}
+
+// affine maps (x,y) to (m[0]x + m[1]y + m[2], m[3]x + m[4]y + m[5])
+type affine [6]float64
+
+func (m affine) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[1]*y + m[2], m[3]*x + m[4]*y + m[5]
+}
+
+// fitAffine solves for the affine transform through three matches
+func fitAffine(a, b []Feature, matches []Match) (affine, bool) {
+	m := make([][]float64, 3)
+	for i, match := range matches {
+		fa, fb := a[match.A], b[match.B]
+		m[i] = []float64{fa.X, fa.Y, 1, fb.X, fb.Y}
+	}
+	if err := solveLinear(m); err != nil {
+		return affine{}, false
+	}
+	return affine{m[0][3], m[1][3], m[2][3], m[0][4], m[1][4], m[2][4]}, true
+}
+
+// SuggestImagePoints proposes correspondences across images, which must all
+// be the same size: it detects features in each, matches each image to the
+// next, and keeps the features that can be followed through every image.
+// The result has one list of points per image, suitable for
+// WarpJob.ImagePoints.
+func SuggestImagePoints(images []*image.NRGBA, opts FeatureOptions) ([][]delaunay.Point, error) {
+	if len(images) < 2 {
+		return nil, fmt.Errorf("need at least two images to match")
+	}
+	size := images[0].Bounds().Size()
+	threshold := opts.threshold() * math.Hypot(float64(size.X), float64(size.Y))
+
+	features := make([][]Feature, len(images))
+	var wg sync.WaitGroup
+	for i, img := range images {
+		if img.Bounds().Size() != size {
+			return nil, fmt.Errorf("all images must be of the same size: image 0 is %v, image %d is %v", size, i, img.Bounds().Size())
+		}
+		wg.Go(func() {
+			features[i] = DetectFeatures(img, opts.maxFeatures())
+		})
+	}
+	wg.Wait()
+
+	// Follow each feature of the first image through the matches to the
+	// following images. tracks[t][i] is the feature of image i on track t.
+	type track struct {
+		features []int
+		distance int // Total descriptor distance, lower is more reliable
+	}
+	tracks := make([]track, len(features[0]))
+	for i := range tracks {
+		tracks[i].features = []int{i}
+	}
+	for i := 1; i < len(images); i++ {
+		matches := ransacAffine(features[i-1], features[i], MatchFeatures(features[i-1], features[i], opts.ratio()), threshold)
+		next := make(map[int]Match, len(matches))
+		for _, m := range matches {
+			next[m.A] = m
+		}
+		var kept []track
+		for _, t := range tracks {
+			if m, ok := next[t.features[i-1]]; ok {
+				t.features = append(t.features, m.B)
+				t.distance += m.Distance
+				kept = append(kept, t)
+			}
+		}
+		tracks = kept
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no features could be matched across all images")
+	}
+
+	// Prefer the most reliable tracks, skipping any that land on the same
+	// pixel as one already chosen, which would break triangulation
+	slices.SortStableFunc(tracks, func(a, b track) int { return a.distance - b.distance })
+	points := make([][]delaunay.Point, len(images))
+	used := make([]map[image.Point]bool, len(images))
+	for i := range used {
+		used[i] = make(map[image.Point]bool)
+	}
+	for _, t := range tracks {
+		if len(points[0]) >= opts.maxPoints() {
+			break
+		}
+		duplicate := false
+		for i, f := range t.features {
+			if used[i][image.Pt(int(features[i][f].X), int(features[i][f].Y))] {
+				duplicate = true
+			}
+		}
+		if duplicate {
+			continue
+		}
+		for i, f := range t.features {
+			p := delaunay.Point{X: features[i][f].X, Y: features[i][f].Y}
+			used[i][image.Pt(int(p.X), int(p.Y))] = true
+			points[i] = append(points[i], p)
+		}
+	}
+	return points, nil
+}
+
+// AddImagePoints appends one point per image to ImagePoints for each
+// correspondence in points, which has a list of points per image as returned
+// by SuggestImagePoints. Correspondences landing on a pixel already holding a
+// point are skipped, as coincident points break triangulation. It returns the
+// number of correspondences added.
+func (s *WarpJobSaveFormat) AddImagePoints(points [][]delaunay.Point) (int, error) {
+	if len(s.Images) == 0 {
+		return 0, fmt.Errorf("job has no images")
+	}
+	if len(points) != len(s.Images) {
+		return 0, fmt.Errorf("have points for %d images, job has %d", len(points), len(s.Images))
+	}
+	for i := range points {
+		if len(points[i]) != len(points[0]) {
+			return 0, fmt.Errorf("have %d points for image %d, but %d for image 0", len(points[i]), i, len(points[0]))
+		}
+	}
+	for len(s.ImagePoints) < len(s.Images) {
+		s.ImagePoints = append(s.ImagePoints, nil)
+	}
+	used := make([]map[image.Point]bool, len(s.Images))
+	for i, imagePoints := range s.ImagePoints {
+		if len(imagePoints) != len(s.ImagePoints[0]) {
+			return 0, fmt.Errorf("image %d has %d points, image 0 has %d", i, len(imagePoints), len(s.ImagePoints[0]))
+		}
+		used[i] = make(map[image.Point]bool)
+		for _, p := range imagePoints {
+			used[i][image.Pt(p[0], p[1])] = true
+		}
+	}
+
+	added := 0
+	for j := range points[0] {
+		rounded := make([]image.Point, len(points))
+		duplicate := false
+		for i := range points {
+			rounded[i] = image.Pt(int(math.Round(points[i][j].X)), int(math.Round(points[i][j].Y)))
+			duplicate = duplicate || used[i][rounded[i]]
+		}
+		if duplicate {
+			continue
+		}
+		for i, p := range rounded {
+			used[i][p] = true
+			s.ImagePoints[i] = append(s.ImagePoints[i], []int{p.X, p.Y})
+		}
+		added++
+	}
+	return added, nil
+}
+
+// SuggestPoints detects correspondences across the job's images with
+// SuggestImagePoints, and adds them to ImagePoints. It returns the number of
+// correspondences added.
+func (s *WarpJobSaveFormat) SuggestPoints(opts FeatureOptions) (int, error) {
+	images := make([]*image.NRGBA, len(s.Images))
+	for i, filename := range s.Images {
+		img, err := LoadImage(filename)
+		if err != nil {
+			return 0, err
+		}
+		images[i] = img
+	}
+	points, err := SuggestImagePoints(images, opts)
+	if err != nil {
+		return 0, err
+	}
+	return s.AddImagePoints(points)
+}
@@ -0,0 +1,68 @@
+package warp
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// createTexturedImage draws random overlapping rectangles, which give plenty
+// of distinct corners, offset by (dx, dy)
+func createTexturedImage(width, height, dx, dy int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 60; i++ {
+		x0, y0 := rng.IntN(width)-20, rng.IntN(height)-20
+		w, h := 5+rng.IntN(30), 5+rng.IntN(30)
+		c := color.NRGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255}
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				if image.Pt(x+dx, y+dy).In(img.Rect) {
+					img.SetNRGBA(x+dx, y+dy, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestSuggestImagePointsShifted(t *testing.T) {
+	a := createTexturedImage(200, 150, 0, 0)
+	b := createTexturedImage(200, 150, 7, -4)
+	points, err := SuggestImagePoints([]*image.NRGBA{a, b}, FeatureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || len(points[0]) != len(points[1]) {
+		t.Fatalf("got %d lists of points, want 2 of equal length", len(points))
+	}
+	if len(points[0]) < 10 {
+		t.Fatalf("only %d points suggested, want at least 10", len(points[0]))
+	}
+	for i := range points[0] {
+		d := sub(points[1][i], points[0][i])
+		if math.Abs(d.X-7) > 1.5 || math.Abs(d.Y+4) > 1.5 {
+			t.Errorf("point %d: %v -> %v, want a shift of (7, -4)", i, points[0][i], points[1][i])
+		}
+	}
+}
+
+func TestSuggestImagePointsSizeMismatch(t *testing.T) {
+	a := createTexturedImage(200, 150, 0, 0)
+	b := createTexturedImage(100, 150, 0, 0)
+	if _, err := SuggestImagePoints([]*image.NRGBA{a, b}, FeatureOptions{}); err == nil {
+		t.Error("expected an error for images of different sizes")
+	}
+}
+
+func TestAddImagePointsEmptyJob(t *testing.T) {
+	var job WarpJobSaveFormat
+	if _, err := job.AddImagePoints(nil); err == nil {
+		t.Error("expected an error for a job without images")
+	}
+}
@@ -0,0 +1,113 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/delaunay"
+)
+
+// Line is a directed feature line segment, from P to Q
+type Line struct {
+	P, Q delaunay.Point
+}
+
+// FieldParams are the Beier-Neely weighting parameters. Each line's influence
+// on a pixel is (length^P / (A + dist))^B, where dist is the pixel's distance
+// from the line. A near 0 pins pixels on a line exactly to it, larger B makes
+// influence fall off faster, and P controls how much longer lines dominate.
+type FieldParams struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+	P float64 `json:"p"`
+}
+
+var DefaultFieldParams = FieldParams{A: 1, B: 2, P: 0.5}
+
+// lerpLines linearly interpolates the endpoints of two equal length line lists
+func lerpLines(from, to []Line, t float64) []Line {
+	lines := make([]Line, len(from))
+	for i := range from {
+		lines[i] = Line{
+			P: delaunay.Point{X: from[i].P.X + (to[i].P.X-from[i].P.X)*t, Y: from[i].P.Y + (to[i].P.Y-from[i].P.Y)*t},
+			Q: delaunay.Point{X: from[i].Q.X + (to[i].Q.X-from[i].Q.X)*t, Y: from[i].Q.Y + (to[i].Q.Y-from[i].Q.Y)*t},
+		}
+	}
+	return lines
+}
+
+// WarpImageLines warps srcImg using Beier-Neely field morphing. dstLines are
+// the feature lines in the geometry of the output image, and srcLines the
+// matching lines in srcImg. Every output pixel is mapped back to srcImg by a
+// weighted average of its position relative to each line.
+func WarpImageLines(srcImg *image.NRGBA, dstLines, srcLines []Line, params FieldParams, opts WarpOptions) (*image.NRGBA, error) {
+	if len(dstLines) != len(srcLines) {
+		return nil, fmt.Errorf("source and destination line lists must have the same length")
+	}
+	dstImg := image.NewNRGBA(srcImg.Bounds())
+	warpInverse(srcImg, dstImg, fieldMapping(dstLines, srcLines, params), opts)
+	return dstImg, nil
+}
+
+// fieldMapping returns the Beier-Neely mapping from the geometry of dstLines
+// back to that of srcLines, which must be the same length
+func fieldMapping(dstLines, srcLines []Line, params FieldParams) func(x, y float64) (float64, float64) {
+	type fieldLine struct {
+		p, d       delaunay.Point // Start point & direction in the output
+		srcP, srcD delaunay.Point // Start point & direction in srcImg
+		lenSq      float64
+		length     float64
+		srcLen     float64
+		strength   float64 // length^P
+	}
+	lines := make([]fieldLine, 0, len(dstLines))
+	for i := range dstLines {
+		d := sub(dstLines[i].Q, dstLines[i].P)
+		srcD := sub(srcLines[i].Q, srcLines[i].P)
+		lenSq := d.X*d.X + d.Y*d.Y
+		srcLen := math.Hypot(srcD.X, srcD.Y)
+		if lenSq < 1e-12 || srcLen < 1e-6 {
+			continue // Zero length lines have no direction; ignore them
+		}
+		lines = append(lines, fieldLine{
+			p: dstLines[i].P, d: d,
+			srcP: srcLines[i].P, srcD: srcD,
+			lenSq:    lenSq,
+			length:   math.Sqrt(lenSq),
+			srcLen:   srcLen,
+			strength: math.Pow(math.Sqrt(lenSq), params.P),
+		})
+	}
+
+	return func(x, y float64) (float64, float64) {
+		var sumX, sumY, totalWeight float64
+		for _, l := range lines {
+			rel := delaunay.Point{X: x - l.p.X, Y: y - l.p.Y}
+			// u is the fraction along the line, v the signed perpendicular distance
+			u := (rel.X*l.d.X + rel.Y*l.d.Y) / l.lenSq
+			v := (rel.X*-l.d.Y + rel.Y*l.d.X) / l.length
+
+			sx := l.srcP.X + u*l.srcD.X + v*-l.srcD.Y/l.srcLen
+			sy := l.srcP.Y + u*l.srcD.Y + v*l.srcD.X/l.srcLen
+
+			var dist float64
+			switch {
+			case u < 0:
+				dist = math.Hypot(rel.X, rel.Y)
+			case u > 1:
+				dist = math.Hypot(x-l.p.X-l.d.X, y-l.p.Y-l.d.Y)
+			default:
+				dist = math.Abs(v)
+			}
+			weight := math.Pow(l.strength/math.Max(params.A+dist, 1e-9), params.B)
+			sumX += (sx - x) * weight
+			sumY += (sy - y) * weight
+			totalWeight += weight
+		}
+		if totalWeight == 0 {
+			return x, y
+		}
+		return x + sumX/totalWeight, y + sumY/totalWeight
+	}
+}
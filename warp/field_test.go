@@ -0,0 +1,64 @@
+package warp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+func TestWarpImageLinesIdentity(t *testing.T) {
+	src := createTexturedImage(40, 30, 0, 0)
+	lines := []Line{
+		{P: delaunay.Point{X: 5, Y: 5}, Q: delaunay.Point{X: 30, Y: 8}},
+		{P: delaunay.Point{X: 10, Y: 25}, Q: delaunay.Point{X: 12, Y: 10}},
+	}
+	dst, err := WarpImageLines(src, lines, lines, DefaultFieldParams, WarpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := imageDifference(dst, src, 1); n > 0 {
+		t.Errorf("identical lines changed %d pixels", n)
+	}
+}
+
+func TestFieldMappingOnLine(t *testing.T) {
+	dstLines := []Line{{P: delaunay.Point{X: 10, Y: 10}, Q: delaunay.Point{X: 30, Y: 10}}}
+	srcLines := []Line{{P: delaunay.Point{X: 5, Y: 20}, Q: delaunay.Point{X: 5, Y: 60}}}
+	mapping := fieldMapping(dstLines, srcLines, DefaultFieldParams)
+	// With a single line, points along it land the same fraction along the
+	// source line
+	for _, u := range []float64{0, 0.25, 0.5, 1} {
+		x, y := mapping(10+20*u, 10)
+		if math.Abs(x-5) > 1e-9 || math.Abs(y-(20+40*u)) > 1e-9 {
+			t.Errorf("u=%g: mapped to (%g, %g), want (5, %g)", u, x, y, 20+40*u)
+		}
+	}
+}
+
+func TestFieldMappingIgnoresZeroLengthLines(t *testing.T) {
+	dstLines := []Line{{P: delaunay.Point{X: 10, Y: 10}, Q: delaunay.Point{X: 30, Y: 12}}}
+	srcLines := []Line{{P: delaunay.Point{X: 12, Y: 8}, Q: delaunay.Point{X: 31, Y: 15}}}
+	mapping := fieldMapping(dstLines, srcLines, DefaultFieldParams)
+
+	// A degenerate line on either side has no direction, so it must not
+	// affect the mapping, or turn it into NaNs
+	point := delaunay.Point{X: 20, Y: 20}
+	withZero := fieldMapping(
+		append(dstLines, Line{P: point, Q: point}, Line{P: point, Q: delaunay.Point{X: 25, Y: 20}}),
+		append(srcLines, Line{P: point, Q: delaunay.Point{X: 22, Y: 20}}, Line{P: point, Q: point}),
+		DefaultFieldParams)
+	for _, p := range []delaunay.Point{{X: 0, Y: 0}, {X: 20, Y: 20}, {X: 35, Y: 5}} {
+		wx, wy := mapping(p.X, p.Y)
+		gx, gy := withZero(p.X, p.Y)
+		if math.Abs(gx-wx) > 1e-9 || math.Abs(gy-wy) > 1e-9 {
+			t.Errorf("%v: mapped to (%g, %g) with zero length lines, want (%g, %g)", p, gx, gy, wx, wy)
+		}
+	}
+
+	// With only zero length lines, nothing moves
+	identity := fieldMapping([]Line{{P: point, Q: point}}, []Line{{P: point, Q: point}}, DefaultFieldParams)
+	if x, y := identity(3, 4); x != 3 || y != 4 {
+		t.Errorf("zero length lines only: mapped (3, 4) to (%g, %g)", x, y)
+	}
+}
@@ -0,0 +1,173 @@
+package warp
+
+import (
+	"context"
+	"image"
+	"iter"
+	"sync"
+)
+
+// FrameInfo describes where a frame yielded by Frames sits in the morph
+type FrameInfo struct {
+	Index      int     // Position in the whole sequence, from 0
+	Transition int     // The frame morphs from Images[Transition] to the next image
+	T          float64 // Linear time through the transition (0.0 - 1.0), before easing
+
+	// Err is set if rendering failed or ctx was cancelled. It is only ever
+	// set on the last FrameInfo yielded, which has no image.
+	Err error
+}
+
+// totalFrames returns the number of frames in the whole sequence, using
+// frameCount for transitions without their own timing
+func (w *WarpJob) totalFrames(frameCount int) int {
+	return len(w.frameSequence(frameCount))
+}
+
+// Frames renders the morph in memory, yielding each frame of the sequence in
+// order. frameCount is the number of frames for transitions without their own
+// timing. Up to ThreadCount frames are rendered concurrently, ahead of the
+// consumer. Stopping the iteration early, or cancelling ctx, stops rendering.
+// The copies of a held image (see Sequence.Hold) are rendered once and share
+// the same image, so yielded images must not be modified.
+func (w *WarpJob) Frames(ctx context.Context, frameCount int) iter.Seq2[FrameInfo, *image.NRGBA] {
+	return func(yield func(FrameInfo, *image.NRGBA) bool) {
+		cache, err := w.setup()
+		if err != nil {
+			yield(FrameInfo{Err: err}, nil)
+			return
+		}
+		// Each frame holds a worker while it renders, and spare workers help
+		// render bands of the frames in progress
+		jobCount := cache.pool
+
+		// A frame being rendered, shared by every copy of a held frame
+		type render struct {
+			done chan struct{}
+			img  *image.NRGBA
+			err  error
+		}
+		type pendingFrame struct {
+			info   FrameInfo
+			render *render
+		}
+		failed := func(err error) *render {
+			r := &render{done: make(chan struct{}), err: err}
+			close(r.done)
+			return r
+		}
+		// Frames are queued in order as they start, so the consumer can wait
+		// on each in turn. The queue length limits how far rendering gets
+		// ahead of a slow consumer.
+		pending := make(chan pendingFrame, w.ThreadCount)
+
+		renderCtx, cancel := context.WithCancel(ctx)
+		var rendering sync.WaitGroup
+		defer rendering.Wait()
+		defer cancel()
+
+		rendering.Go(func() {
+			defer close(pending)
+			sequence := w.frameSequence(frameCount)
+			same := func(a, b FrameInfo) bool { return a.Transition == b.Transition && a.T == b.T }
+			var previous *render
+			for i, info := range sequence {
+				// A held image is still, so it is rendered once without
+				// motion blur, and every copy of it is the same frame
+				repeat := i > 0 && same(info, sequence[i-1])
+				held := repeat || (i+1 < len(sequence) && same(info, sequence[i+1]))
+				if repeat {
+					select {
+					case pending <- pendingFrame{info: info, render: previous}:
+					case <-renderCtx.Done():
+						return
+					}
+					continue
+				}
+
+				triangles, err := w.transitionTriangles(info.Transition)
+				if err != nil {
+					select {
+					case pending <- pendingFrame{render: failed(err)}:
+					case <-renderCtx.Done():
+					}
+					return
+				}
+
+				frame := pendingFrame{info: info, render: &render{done: make(chan struct{})}}
+				previous = frame.render
+				// Queue the frame before taking a worker, so a worker is never
+				// held waiting on the consumer, which may itself be waiting for
+				// a worker
+				select {
+				case pending <- frame:
+				case <-renderCtx.Done():
+					return
+				}
+				select {
+				case jobCount <- struct{}{}:
+				case <-renderCtx.Done():
+					frame.render.err = renderCtx.Err()
+					close(frame.render.done)
+					return
+				}
+				rendering.Go(func() {
+					defer func() { <-jobCount }()
+					interval := frameInterval(w.transitionFrames(info.Transition, frameCount))
+					if held {
+						interval = 0
+					}
+					r := frame.render
+					r.img, r.err = w.blurredFrameAt(renderCtx, info.Transition, info.T, interval, triangles, uint64(info.Index))
+					close(r.done)
+				})
+			}
+		})
+
+		yielded := 0
+		for frame := range pending {
+			<-frame.render.done
+			r := frame.render
+			if err := ctx.Err(); err != nil {
+				yield(FrameInfo{Index: frame.info.Index, Err: err}, nil)
+				return
+			}
+			if r.err != nil {
+				frame.info.Err = r.err
+				yield(frame.info, nil)
+				return
+			}
+			if !yield(frame.info, r.img) {
+				return
+			}
+			yielded++
+		}
+		// Rendering stops early if ctx is cancelled between frames
+		if err := ctx.Err(); err != nil && yielded < w.totalFrames(frameCount) {
+			yield(FrameInfo{Index: yielded, Err: err}, nil)
+		}
+	}
+}
+
+// frameTime returns the linear time (0.0 - 1.0) of frame count of frames
+// in a transition
+func frameTime(count, frames int) float64 {
+	if frames <= 1 {
+		return 1
+	}
+	return float64(count) / float64(frames-1)
+}
+
+// frameAt renders the morph from Images[transition] to the next image at
+// linear time t. triangles is the transition's triangulation, for
+// MethodTriangles. Cancelling ctx abandons the frame part way through.
+func (w *WarpJob) frameAt(ctx context.Context, transition int, t float64, triangles []int) (*image.NRGBA, error) {
+	shape, color := w.progress(transition, t)
+	if w.PerFrameTriangulation && w.Method == MethodTriangles {
+		var err error
+		if triangles, err = w.triangulate(transition, shape); err != nil {
+			return nil, err
+		}
+	}
+	return w.morphFrame(ctx, transition, shape, color, triangles)
+}
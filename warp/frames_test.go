@@ -0,0 +1,188 @@
+package warp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+// testJob builds a three image job with one control point per image
+func testJob() *WarpJob {
+	return &WarpJob{
+		Images: []*image.NRGBA{createTestImage(64, 48), createTestImage(64, 48), createTestImage(64, 48)},
+		ImagePoints: [][]delaunay.Point{
+			{{X: 20, Y: 20}}, {{X: 40, Y: 25}}, {{X: 30, Y: 30}},
+		},
+		Transitions: []Transition{{Frames: 3}},
+		ThreadCount: 3,
+	}
+}
+
+func TestFramesInOrder(t *testing.T) {
+	job := testJob()
+	var got []FrameInfo
+	for info, img := range job.Frames(context.Background(), 5) {
+		if info.Err != nil {
+			t.Fatal(info.Err)
+		}
+		if img == nil {
+			t.Fatalf("frame %d has no image", info.Index)
+		}
+		got = append(got, info)
+	}
+	// 3 frames for the first transition, then the default 5, sharing the
+	// frame of the middle image
+	if len(got) != 7 {
+		t.Fatalf("got %d frames, want 7", len(got))
+	}
+	for i, info := range got {
+		if info.Index != i {
+			t.Errorf("frame %d has index %d", i, info.Index)
+		}
+	}
+	if got[1].Transition != 0 || got[1].T != 0.5 || got[2].Transition != 1 || got[2].T != 0 {
+		t.Errorf("unexpected transition boundary: %+v, %+v", got[1], got[2])
+	}
+}
+
+func TestFramesStopEarly(t *testing.T) {
+	job := testJob()
+	count := 0
+	for range job.Frames(context.Background(), 50) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("got %d frames, want 2", count)
+	}
+}
+
+func TestFramesCancelled(t *testing.T) {
+	job := testJob()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last FrameInfo
+	for info := range job.Frames(ctx, 50) {
+		last = info
+		cancel()
+	}
+	if !errors.Is(last.Err, context.Canceled) {
+		t.Errorf("last frame error = %v, want context.Canceled", last.Err)
+	}
+}
+
+func TestRenderFrameMatchesFrames(t *testing.T) {
+	job := testJob()
+	for info, img := range job.Frames(context.Background(), 5) {
+		if info.Err != nil {
+			t.Fatal(info.Err)
+		}
+		frame, err := job.RenderFrame(info.Transition, info.T)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame.Pix, img.Pix) {
+			t.Errorf("RenderFrame(%d, %g) differs from frame %d", info.Transition, info.T, info.Index)
+		}
+	}
+	if _, err := job.RenderFrame(2, 0.5); err == nil {
+		t.Error("expected an error for a transition past the last image")
+	}
+}
+
+func TestRenderFrameAfterEdit(t *testing.T) {
+	// A job which fails validation works once it is fixed
+	job := testJob()
+	points := job.ImagePoints
+	job.ImagePoints = points[:2]
+	if _, err := job.RenderFrame(0, 0.5); err == nil {
+		t.Fatal("expected an error for missing image points")
+	}
+	job.ImagePoints = points
+	if _, err := job.RenderFrame(0, 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving a point after rendering re-triangulates, matching a fresh job
+	moved := [][]delaunay.Point{
+		{{X: 16, Y: 14}, {X: 48, Y: 12}, {X: 46, Y: 36}, {X: 18, Y: 34}},
+		{{X: 16, Y: 14}, {X: 48, Y: 12}, {X: 46, Y: 36}, {X: 18, Y: 34}},
+		{{X: 16, Y: 14}, {X: 48, Y: 12}, {X: 46, Y: 36}, {X: 18, Y: 34}},
+	}
+	job.ImagePoints = moved
+	if _, err := job.RenderFrame(0, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	moved[1][2] = delaunay.Point{X: 22, Y: 18}
+	got, err := job.RenderFrame(0, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := testJob()
+	fresh.ImagePoints = moved
+	want, err := fresh.RenderFrame(0, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("frame after moving a point differs from a fresh job's")
+	}
+}
+
+func TestRunContextSingleThread(t *testing.T) {
+	// Rendering & saving share the only worker, so must take turns
+	job := testJob()
+	job.ThreadCount = 1
+	dir := t.TempDir()
+	if err := job.RunContext(context.Background(), filepath.Join(dir, "frame"), 5); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != job.totalFrames(5) {
+		t.Errorf("got %d files, want %d", len(entries), job.totalFrames(5))
+	}
+}
+
+func TestRunContextSaveError(t *testing.T) {
+	job := testJob()
+	prefix := filepath.Join(t.TempDir(), "missing", "frame")
+	if err := job.RunContext(context.Background(), prefix, 5); err == nil {
+		t.Fatal("expected an error saving into a missing directory")
+	}
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	job := testJob()
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job.Callback = func(completed, total int) { cancel() }
+
+	err := job.RunContext(ctx, filepath.Join(dir, "frame"), 50)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) >= job.totalFrames(50) {
+		t.Errorf("got %d frames, want the run to stop early", len(entries))
+	}
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".png" {
+			t.Errorf("left behind temporary file %s", e.Name())
+		}
+	}
+}
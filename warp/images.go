@@ -6,8 +6,11 @@ import (
 	"image/draw"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 func LoadImage(filename string) (*image.NRGBA, error) {
@@ -31,26 +34,51 @@ func LoadImage(filename string) (*image.NRGBA, error) {
 	return rgbaImg, nil
 }
 
-func SaveImage(img image.Image, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
+// SaveImage writes img to filename, in the format given by its extension. It
+// is written to a temporary file first and renamed into place, so a failed
+// or interrupted save never leaves a partial image behind. The file gets the
+// same permissions os.Create would give it, under the user's umask.
+func SaveImage(img image.Image, filename string) (err error) {
 	ext := filepath.Ext(filename)
+	var encode func(io.Writer, image.Image) error
 	switch ext {
 	case ".jpeg", ".jpg":
-		if err := jpeg.Encode(file, img, nil); err != nil {
-			return err
-		}
+		encode = func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) }
 	case ".png":
-		if err := png.Encode(file, img); err != nil {
-			return err
-		}
+		encode = png.Encode
 	default:
 		return fmt.Errorf("unsupported image format: %s", ext)
 	}
 
-	return nil
+	file, err := createTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	if err := encode(file, img); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// createTemp creates a new file in dir, named prefix and a random suffix.
+// Unlike os.CreateTemp, which makes the file private, it is created with the
+// permissions os.Create uses, so the umask applies.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(rand.Uint64(), 36))
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 100 {
+			continue
+		}
+		return file, err
+	}
 }
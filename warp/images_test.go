@@ -0,0 +1,35 @@
+package warp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveImagePermissions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "frame.png")
+	if err := SaveImage(createTestImage(4, 4), filename); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The umask applies, as it would to a file made by os.Create
+	created, err := os.Create(filepath.Join(t.TempDir(), "created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer created.Close()
+	want, err := created.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != want.Mode().Perm() {
+		t.Errorf("saved with mode %v, want %v as os.Create gives", mode, want.Mode().Perm())
+	}
+	// Only the image is left behind
+	if entries, _ := os.ReadDir(filepath.Dir(filename)); len(entries) != 1 {
+		t.Errorf("%d files in the output directory, want 1", len(entries))
+	}
+}
@@ -0,0 +1,74 @@
+package warp
+
+import (
+	"image"
+)
+
+// DefaultGridStep is the spacing, in pixels, at which inverse mapped warps
+// evaluate their mapping when WarpOptions.GridStep is 0
+const DefaultGridStep = 8
+
+// warpInverse fills dst by mapping every pixel back into src and sampling it
+// there. Like the samplers, it places pixel centres at integer coordinates.
+// Smooth mappings are expensive to evaluate, so the mapping is only evaluated
+// on a grid every opts.GridStep pixels, and bilinearly interpolated in
+// between. Both the grid and the pixels are computed in bands, spread over the
+// threads in opts.
+func warpInverse(src, dst *image.NRGBA, mapping func(x, y float64) (float64, float64), opts WarpOptions) {
+	sampler := opts.sampler()
+	bilinear := opts.fastBilinear()
+	step := opts.gridStep()
+	pool := opts.workers()
+	b := dst.Bounds()
+
+	// Grid nodes at every step pixels, plus one at the far edge
+	cols := (b.Dx()+step-1)/step + 1
+	rows := (b.Dy()+step-1)/step + 1
+	gridX := make([]float64, cols*rows)
+	gridY := make([]float64, cols*rows)
+	pool.forEach(opts.context(), rows, func(j int) {
+		for i := 0; i < cols; i++ {
+			x := float64(b.Min.X + min(i*step, b.Dx()-1))
+			y := float64(b.Min.Y + min(j*step, b.Dy()-1))
+			gridX[j*cols+i], gridY[j*cols+i] = mapping(x, y)
+		}
+	})
+
+	bands := pool.bands(b)
+	pool.forEach(opts.context(), len(bands), func(band int) {
+		for y := bands[band].Min.Y; y < bands[band].Max.Y; y++ {
+			j := (y - b.Min.Y) / step
+			fy := gridFraction(y-b.Min.Y, j, step, b.Dy())
+			off := dst.PixOffset(b.Min.X, y)
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := (x - b.Min.X) / step
+				fx := gridFraction(x-b.Min.X, i, step, b.Dx())
+
+				n00 := j*cols + i
+				n10, n01, n11 := n00+1, n00+cols, n00+cols+1
+				sx := (gridX[n00]*(1-fx)+gridX[n10]*fx)*(1-fy) + (gridX[n01]*(1-fx)+gridX[n11]*fx)*fy
+				sy := (gridY[n00]*(1-fx)+gridY[n10]*fx)*(1-fy) + (gridY[n01]*(1-fx)+gridY[n11]*fx)*fy
+
+				pix := dst.Pix[off : off+4 : off+4]
+				if bilinear {
+					pix[0], pix[1], pix[2], pix[3] = sampleBilinearFast(src, sx, sy)
+				} else {
+					c := sampler.Sample(src, sx, sy, opts.Border)
+					pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, c.A
+				}
+				off += 4
+			}
+		}
+	})
+}
+
+// gridFraction returns how far pos is between grid node idx and idx+1. The
+// last node is clamped to the final pixel, so the last cell may be narrower.
+func gridFraction(pos, idx, step, size int) float64 {
+	start := idx * step
+	end := min((idx+1)*step, size-1)
+	if end <= start {
+		return 0
+	}
+	return float64(pos-start) / float64(end-start)
+}
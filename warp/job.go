@@ -1,122 +1,335 @@
 package warp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
-	"image/draw"
 	"log"
 	"os"
-	"runtime"
 	"sync"
 	"sync/atomic"
 
 	"github.com/fogleman/delaunay"
 )
 
+// WarpMethod selects how each image is warped into the intermediate geometry
+type WarpMethod int
+
+const (
+	// MethodTriangles is a piecewise affine warp over a Delaunay triangulation of ImagePoints
+	MethodTriangles WarpMethod = iota
+	// MethodFieldLines is Beier-Neely field morphing driven by ImageLines
+	MethodFieldLines
+	// MethodThinPlate is a thin plate spline warp through ImagePoints
+	MethodThinPlate
+	// MethodMLS is a moving least squares deformation driven by ImagePoints
+	MethodMLS
+	// MethodMesh is a two-pass mesh warp driven by ImageLattices
+	MethodMesh
+)
+
+// WarpMethodByName looks up a warp method from its command line/json name
+func WarpMethodByName(name string) (WarpMethod, error) {
+	switch name {
+	case "", "triangles":
+		return MethodTriangles, nil
+	case "lines":
+		return MethodFieldLines, nil
+	case "tps":
+		return MethodThinPlate, nil
+	case "mls":
+		return MethodMLS, nil
+	case "mesh":
+		return MethodMesh, nil
+	default:
+		return 0, fmt.Errorf("unknown warp method: %q", name)
+	}
+}
+
 type WarpJob struct {
 	Images      []*image.NRGBA
 	ImagePoints [][]delaunay.Point
-	ThreadCount int // Number of concurrent threads to use. If set to 0, uses auto detected CPU count
+	ImageLines  [][]Line // Feature lines for MethodFieldLines
+	// ImageLattices are the control lattices for MethodMesh
+	ImageLattices []Lattice
+	Method        WarpMethod
+	FieldParams   FieldParams // Weighting for MethodFieldLines. If zero, uses DefaultFieldParams
+	// Regularization smooths MethodThinPlate, rather than passing exactly
+	// through every point. It is relative to the mean squared point spacing.
+	Regularization float64
+	MLSVariant     MLSVariant // Transform family for MethodMLS. Defaults to rigid
+	// Trajectory is the path points and lines follow through the images.
+	// Lattices always move linearly, as a spline could fold them.
+	Trajectory Trajectory
+	// Transitions holds the timing of the morph from each image to the
+	// next. Missing entries use the frame count passed to Run, with linear easing.
+	Transitions []Transition
+	Sequence    Sequence   // Held images and looping
+	MotionBlur  MotionBlur // Averaging of sub-frames, for fast transitions
+	FPS         float64    // Frame rate used to convert Transition.Duration into frames
+	ThreadCount int        // Number of concurrent threads to use. If set to 0, uses auto detected CPU count
 	Callback    func(completed int, total int)
+	Sampler     Sampler   // Resampling filter used when warping. If nil, uses bilinear
+	AntiAlias   bool      // Use coverage based anti-aliasing on triangle edges (see WarpOptions)
+	GridStep    int       // Mapping grid spacing for smooth warp methods (see WarpOptions)
+	BlendMode   BlendMode // Colour space for the cross-dissolve. Defaults to BlendSRGB
+	Border      Border    // Sampling outside the source images. Defaults to clamping to the edges
+
+	// PerFrameTriangulation triangulates the interpolated points of every
+	// frame, rather than once per transition on the averaged points
+	PerFrameTriangulation bool
+
+	cacheMutex sync.Mutex
+	cache      *renderCache // Set up on first render
 }
 
 type WarpJobSaveFormat struct {
 	Images      []string  `json:"images"`
 	ImagePoints [][][]int `json:"image_points"`
+	// ImageLines holds each image's feature lines, as [x1, y1, x2, y2]
+	ImageLines    [][][]int           `json:"image_lines,omitempty"`
+	ImageLattices []LatticeSaveFormat `json:"image_lattices,omitempty"`
+	Method        string              `json:"method,omitempty"` // "triangles" (default), "lines", "tps", "mls" or "mesh"
+	FieldParams   *FieldParams        `json:"field_params,omitempty"`
+
+	Regularization float64 `json:"regularization,omitempty"`
+	MLSVariant     string  `json:"mls_variant,omitempty"` // "rigid" (default), "similarity" or "affine"
+	Trajectory     string  `json:"trajectory,omitempty"`  // "linear" (default), "catmull-rom" or "centripetal"
+
+	Transitions []TransitionSaveFormat `json:"transitions,omitempty"`
+	Sequence    *SequenceSaveFormat    `json:"sequence,omitempty"`
+	MotionBlur  *MotionBlurSaveFormat  `json:"motion_blur,omitempty"`
+	FPS         float64                `json:"fps,omitempty"`
 }
 
-func (w *WarpJob) Run(filePrefix string, frameCount int) error {
+// LatticeSaveFormat is the json form of a Lattice
+type LatticeSaveFormat struct {
+	Rows   int     `json:"rows"`
+	Cols   int     `json:"cols"`
+	Points [][]int `json:"points"`
+}
+
+// validate checks the job has consistent images and correspondences for its
+// warp method
+func (w *WarpJob) validate() error {
 	if len(w.Images) < 2 {
 		return fmt.Errorf("need at least two images to warp")
 	}
-	if len(w.ImagePoints) != len(w.Images) {
-		return fmt.Errorf("need the same number of image points as images (have %d images, %d image points)", len(w.Images), len(w.ImagePoints))
-	}
 	for i := 1; i < len(w.Images); i++ {
 		if w.Images[i].Bounds().Dx() != w.Images[0].Bounds().Dx() || w.Images[i].Bounds().Dy() != w.Images[0].Bounds().Dy() {
 			return fmt.Errorf("all images must be of the same size: image 0 is %v, image %d is %v", w.Images[0].Bounds(), i, w.Images[i].Bounds())
 		}
 	}
-	for i := 1; i < len(w.ImagePoints); i++ {
-		if len(w.ImagePoints[i]) != len(w.ImagePoints[0]) {
-			return fmt.Errorf("need the same number of points for all images. image0 has %d, image %d has %d", len(w.ImagePoints[0]), i, len(w.ImagePoints[i]))
+	for i, tr := range w.Transitions {
+		if tr.Frames <= 0 && tr.Duration > 0 && w.FPS <= 0 {
+			return fmt.Errorf("transition %d has a duration, but the job has no fps", i)
+		}
+		if tr.Mask != nil && tr.Mask.Bounds().Size() != w.Images[0].Bounds().Size() {
+			return fmt.Errorf("transition %d mask is %v, but images are %v", i, tr.Mask.Bounds(), w.Images[0].Bounds())
 		}
 	}
-	bounds := w.Images[0].Bounds()
-	img0Points := []delaunay.Point{{0, 0}, {float64(bounds.Dx() - 1), 0},
-		{0, float64(bounds.Dy() - 1)}, {float64(bounds.Dx() - 1), float64(bounds.Dy() - 1)}}
-	img0Points = append(img0Points, w.ImagePoints[0]...)
+	switch w.Method {
+	case MethodTriangles, MethodThinPlate, MethodMLS:
+		if len(w.ImagePoints) != len(w.Images) {
+			return fmt.Errorf("need the same number of image points as images (have %d images, %d image points)", len(w.Images), len(w.ImagePoints))
+		}
+		for i := 1; i < len(w.ImagePoints); i++ {
+			if len(w.ImagePoints[i]) != len(w.ImagePoints[0]) {
+				return fmt.Errorf("need the same number of points for all images. image0 has %d, image %d has %d", len(w.ImagePoints[0]), i, len(w.ImagePoints[i]))
+			}
+		}
+	case MethodFieldLines:
+		if len(w.ImageLines) != len(w.Images) {
+			return fmt.Errorf("need the same number of image lines as images (have %d images, %d image lines)", len(w.Images), len(w.ImageLines))
+		}
+		for i := 1; i < len(w.ImageLines); i++ {
+			if len(w.ImageLines[i]) != len(w.ImageLines[0]) {
+				return fmt.Errorf("need the same number of lines for all images. image0 has %d, image %d has %d", len(w.ImageLines[0]), i, len(w.ImageLines[i]))
+			}
+		}
+	case MethodMesh:
+		if len(w.ImageLattices) != len(w.Images) {
+			return fmt.Errorf("need the same number of image lattices as images (have %d images, %d image lattices)", len(w.Images), len(w.ImageLattices))
+		}
+		for i, lattice := range w.ImageLattices {
+			if lattice.Rows != w.ImageLattices[0].Rows || lattice.Cols != w.ImageLattices[0].Cols {
+				return fmt.Errorf("need the same lattice size for all images. image0 has %dx%d, image %d has %dx%d", w.ImageLattices[0].Rows, w.ImageLattices[0].Cols, i, lattice.Rows, lattice.Cols)
+			}
+			if err := lattice.validate(); err != nil {
+				return fmt.Errorf("image %d: %w", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown warp method: %d", w.Method)
+	}
+	return nil
+}
+
+// Run renders the whole morph sequence to filePrefix-%05d.png. frameCount is
+// the number of frames for any transition without its own timing.
+func (w *WarpJob) Run(filePrefix string, frameCount int) error {
+	return w.RunContext(context.Background(), filePrefix, frameCount)
+}
 
-	triangulate, err := delaunay.Triangulate(img0Points)
+// RunContext is Run, stopping early if ctx is cancelled. Frames are saved
+// concurrently, and the first error from rendering or saving stops the rest
+// and is returned. Frames that were only partially written are removed.
+func (w *WarpJob) RunContext(ctx context.Context, filePrefix string, frameCount int) error {
+	cache, err := w.setup()
 	if err != nil {
-		return fmt.Errorf("unable to triangulate image 1: %v", err)
+		return err
 	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-	fileCount := 0
-	prevImage := w.Images[0]
-	if w.ThreadCount <= 0 {
-		w.ThreadCount = runtime.NumCPU()
-	}
-	jobCount := make(chan struct{}, w.ThreadCount)
-	total := frameCount * (len(w.Images) - 1)
+	total := w.totalFrames(frameCount)
 	var completed atomic.Int64
-	for imageIdx := 1; imageIdx < len(w.Images); imageIdx++ {
-
-		parallel := sync.WaitGroup{}
-		var prevImageCandidate *image.NRGBA
-		for count := 0; count < frameCount; count++ {
-			filename := fmt.Sprintf("%s-%05d.png", filePrefix, fileCount)
-			fileCount++
-			jobCount <- struct{}{}
-			parallel.Go(func() {
-
-				alpha := float64(count) / float64(frameCount-1) // Range from 0.0 - 1.0
-
-				sourcePoints := make([]delaunay.Point, len(triangulate.Triangles))
-				destPoints := make([]delaunay.Point, len(triangulate.Triangles))
-
-				imgPoints := []delaunay.Point{{0, 0}, {float64(bounds.Dx() - 1), 0},
-					{0, float64(bounds.Dy() - 1)}, {float64(bounds.Dx() - 1), float64(bounds.Dy() - 1)}}
-				imgPoints = append(imgPoints, w.ImagePoints[imageIdx]...)
-
-				for i := range triangulate.Triangles {
-					sourcePoints[i] = img0Points[triangulate.Triangles[i]]
-					destPoints[i] = imgPoints[triangulate.Triangles[i]]
-				}
-
-				dst, err := WarpImage(w.Images[imageIdx], sourcePoints, destPoints)
-				if err != nil {
-					log.Fatalf("Cannot warp image: %s", err)
-				}
-
-				// Blend img1 with dst at alpha ratio
-				combined := image.NewNRGBA(dst.Bounds())
-				draw.Draw(combined, combined.Bounds(), prevImage, image.Point{0, 0}, draw.Src)
-				// Set the alpha on dst to alpha
-				alphaInt := uint8(255 * alpha)
-				for y := 0; y < dst.Bounds().Dy(); y++ {
-					for x := 0; x < dst.Bounds().Dx(); x++ {
-						dst.Pix[y*dst.Stride+x*4+3] = alphaInt
-					}
-				}
-				draw.Draw(combined, combined.Bounds(), dst, image.Point{0, 0}, draw.Over)
-				SaveImage(combined, filename)
-				completed.Add(1)
-				if w.Callback != nil {
-					w.Callback(int(completed.Load()), total)
-				}
-
-				if count == frameCount-1 {
-					prevImageCandidate = dst
-				}
-				<-jobCount
-			})
+	var saving sync.WaitGroup
+	for info, img := range w.Frames(ctx, frameCount) {
+		if info.Err != nil {
+			cancel(info.Err)
+			break
 		}
-		parallel.Wait()
-		prevImage = prevImageCandidate
+		// Saving shares the ThreadCount budget with rendering
+		cache.pool <- struct{}{}
+		saving.Go(func() {
+			defer func() { <-cache.pool }()
+			if ctx.Err() != nil {
+				return
+			}
+			filename := fmt.Sprintf("%s-%05d.png", filePrefix, info.Index)
+			if err := SaveImage(img, filename); err != nil {
+				cancel(fmt.Errorf("cannot save %s: %w", filename, err))
+				return
+			}
+			if w.Callback != nil {
+				w.Callback(int(completed.Add(1)), total)
+			}
+		})
+	}
+	saving.Wait()
+	return context.Cause(ctx)
+}
+
+// triangulate builds the triangle topology for the morph from
+// Images[transition] to the next image, using the control points
+// interpolated at time t. The returned indices refer to the padded point lists
+// of either image.
+func (w *WarpJob) triangulate(transition int, t float64) ([]int, error) {
+	bounds := w.Images[transition].Bounds()
+	points := paddedPoints(bounds, w.trajectoryPoints(w.ImagePoints, transition, t))
+
+	triangulation, err := delaunay.Triangulate(points)
+	if err != nil {
+		return nil, fmt.Errorf("unable to triangulate image %d to %d: %v", transition, w.nextImage(transition), err)
+	}
+	return triangulation.Triangles, nil
+}
+
+// morphFrame renders a single frame of the morph from Images[transition] to
+// the next image. The correspondences are interpolated between the two
+// images by shape (0.0 - 1.0), both images are warped into that intermediate
+// geometry, and the results are cross-dissolved by color (0.0 - 1.0).
+// triangles is only used by MethodTriangles. If ctx is cancelled the warps
+// are abandoned, and its error returned.
+func (w *WarpJob) morphFrame(ctx context.Context, transition int, shape, color float64, triangles []int) (*image.NRGBA, error) {
+	next := w.nextImage(transition)
+	from, err := w.warpTo(ctx, w.Images[transition], transition, transition, shape, triangles)
+	if err != nil {
+		return nil, err
+	}
+	to, err := w.warpTo(ctx, w.Images[next], next, transition, shape, triangles)
+	if err != nil {
+		return nil, err
+	}
+
+	// The mask is painted over the first image, so follows its geometry
+	var mask *image.NRGBA
+	if m := w.transition(transition).Mask; m != nil {
+		if mask, err = w.warpTo(ctx, m, transition, transition, shape, triangles); err != nil {
+			return nil, err
+		}
+	}
+	// A cancelled warp stops early, leaving its image unfinished
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return crossDissolve(from, to, color, w.BlendMode, mask), nil
+}
+
+// warpTo warps src, which is in the geometry of Images[imageIdx], into the
+// geometry at time t through the morph from Images[transition] to the next
+// image
+func (w *WarpJob) warpTo(ctx context.Context, src *image.NRGBA, imageIdx, transition int, t float64, triangles []int) (*image.NRGBA, error) {
+	opts := w.warpOptions(ctx)
+	switch w.Method {
+	case MethodFieldLines:
+		params := w.FieldParams
+		if params == (FieldParams{}) {
+			params = DefaultFieldParams
+		}
+		midLines := w.trajectoryLines(w.ImageLines, transition, t)
+		return WarpImageLines(src, midLines, w.ImageLines[imageIdx], params, opts)
+	case MethodThinPlate:
+		bounds := src.Bounds()
+		midPoints := paddedPoints(bounds, w.trajectoryPoints(w.ImagePoints, transition, t))
+		return WarpImageTPS(src, midPoints, paddedPoints(bounds, w.ImagePoints[imageIdx]), w.Regularization, opts)
+	case MethodMLS:
+		bounds := src.Bounds()
+		midPoints := paddedPoints(bounds, w.trajectoryPoints(w.ImagePoints, transition, t))
+		return WarpImageMLS(src, midPoints, paddedPoints(bounds, w.ImagePoints[imageIdx]), w.MLSVariant, opts)
+	case MethodMesh:
+		midLattice := lerpLattice(w.ImageLattices[transition], w.ImageLattices[w.nextImage(transition)], t)
+		return WarpImageMesh(src, midLattice, w.ImageLattices[imageIdx], opts)
+	default:
+		bounds := src.Bounds()
+		midPoints := paddedPoints(bounds, w.trajectoryPoints(w.ImagePoints, transition, t))
+		midTriangles := trianglePoints(midPoints, triangles)
+		srcTriangles := trianglePoints(paddedPoints(bounds, w.ImagePoints[imageIdx]), triangles)
+		return WarpImageOptions(src, midTriangles, srcTriangles, opts)
 	}
-	return nil
+}
+
+func (w *WarpJob) warpOptions(ctx context.Context) WarpOptions {
+	opts := WarpOptions{Sampler: w.Sampler, AntiAlias: w.AntiAlias, GridStep: w.GridStep, Border: w.Border, ctx: ctx}
+	if w.cache != nil {
+		opts.pool = w.cache.pool
+	}
+	return opts
+}
+
+// paddedPoints prefixes the image corners to points, so the triangulation
+// always covers the whole image. Pixel centres are at integer coordinates, so
+// the corners are half a pixel beyond the outermost centres, and every pixel
+// is inside the mesh.
+func paddedPoints(bounds image.Rectangle, points []delaunay.Point) []delaunay.Point {
+	right, bottom := float64(bounds.Dx())-0.5, float64(bounds.Dy())-0.5
+	padded := []delaunay.Point{{-0.5, -0.5}, {right, -0.5}, {-0.5, bottom}, {right, bottom}}
+	return append(padded, points...)
+}
+
+// lerpPoints linearly interpolates between two equal length point lists.
+func lerpPoints(from, to []delaunay.Point, t float64) []delaunay.Point {
+	points := make([]delaunay.Point, len(from))
+	for i := range from {
+		points[i] = delaunay.Point{
+			X: from[i].X + (to[i].X-from[i].X)*t,
+			Y: from[i].Y + (to[i].Y-from[i].Y)*t,
+		}
+	}
+	return points
+}
+
+// trianglePoints expands a triangle index list into the flat vertex list
+// expected by WarpImage.
+func trianglePoints(points []delaunay.Point, triangles []int) []delaunay.Point {
+	result := make([]delaunay.Point, len(triangles))
+	for i, idx := range triangles {
+		result[i] = points[idx]
+	}
+	return result
 }
 
 func LoadWarpJson(filename string) (*WarpJobSaveFormat, error) {
@@ -161,6 +374,67 @@ func NewJobFromJson(jsonData []byte) (*WarpJob, error) {
 	}
 
 	var job WarpJob
+	var err error
+	if job.Method, err = WarpMethodByName(saved.Method); err != nil {
+		return nil, err
+	}
+	job.FieldParams = DefaultFieldParams
+	if saved.FieldParams != nil {
+		job.FieldParams = *saved.FieldParams
+	}
+	job.Regularization = saved.Regularization
+	job.FPS = saved.FPS
+	for i, transition := range saved.Transitions {
+		tr, err := transition.Transition()
+		if err != nil {
+			return nil, fmt.Errorf("transition %d: %w", i, err)
+		}
+		if transition.Mask != "" {
+			if tr.Mask, err = LoadImage(transition.Mask); err != nil {
+				return nil, fmt.Errorf("transition %d mask: %w", i, err)
+			}
+		}
+		job.Transitions = append(job.Transitions, tr)
+	}
+	if saved.Sequence != nil {
+		if job.Sequence, err = saved.Sequence.Sequence(); err != nil {
+			return nil, fmt.Errorf("sequence: %w", err)
+		}
+	}
+	if saved.MotionBlur != nil {
+		if job.MotionBlur, err = saved.MotionBlur.MotionBlur(); err != nil {
+			return nil, err
+		}
+	}
+	if job.Trajectory, err = TrajectoryByName(saved.Trajectory); err != nil {
+		return nil, err
+	}
+	if job.MLSVariant, err = MLSVariantByName(saved.MLSVariant); err != nil {
+		return nil, err
+	}
+	for _, imageLines := range saved.ImageLines {
+		var lines []Line
+		for _, line := range imageLines {
+			if len(line) != 4 {
+				return nil, fmt.Errorf("invalid line format: %v", line)
+			}
+			lines = append(lines, Line{
+				P: delaunay.Point{X: float64(line[0]), Y: float64(line[1])},
+				Q: delaunay.Point{X: float64(line[2]), Y: float64(line[3])},
+			})
+		}
+		job.ImageLines = append(job.ImageLines, lines)
+	}
+	for _, imageLattice := range saved.ImageLattices {
+		lattice := Lattice{Rows: imageLattice.Rows, Cols: imageLattice.Cols}
+		for _, point := range imageLattice.Points {
+			if len(point) != 2 {
+				return nil, fmt.Errorf("invalid lattice point format: %v", point)
+			}
+			lattice.Points = append(lattice.Points, delaunay.Point{X: float64(point[0]), Y: float64(point[1])})
+		}
+		job.ImageLattices = append(job.ImageLattices, lattice)
+	}
 	for _, imagePoints := range saved.ImagePoints {
 		var points []delaunay.Point
 		for _, point := range imagePoints {
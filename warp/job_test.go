@@ -0,0 +1,55 @@
+package warp
+
+import (
+	"image"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+// pairJob builds a two image job whose control points move between the
+// images
+func pairJob(method WarpMethod) *WarpJob {
+	return &WarpJob{
+		Images: []*image.NRGBA{createTestImage(40, 30), createTexturedImage(40, 30, 0, 0)},
+		ImagePoints: [][]delaunay.Point{
+			{{X: 10, Y: 10}, {X: 30, Y: 8}, {X: 20, Y: 22}},
+			{{X: 14, Y: 12}, {X: 27, Y: 6}, {X: 18, Y: 24}},
+		},
+		Method:      method,
+		ThreadCount: 1,
+	}
+}
+
+// imageDifference counts the pixels of a and b with any channel more than
+// tolerance apart
+func imageDifference(a, b *image.NRGBA, tolerance int) int {
+	differ := 0
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 4; c++ {
+			if d := int(a.Pix[i+c]) - int(b.Pix[i+c]); d < -tolerance || d > tolerance {
+				differ++
+				break
+			}
+		}
+	}
+	return differ
+}
+
+func TestRenderFrameEndpointsReproduceImages(t *testing.T) {
+	for _, method := range []WarpMethod{MethodTriangles, MethodThinPlate, MethodMLS} {
+		for _, antiAlias := range []bool{false, true} {
+			job := pairJob(method)
+			job.AntiAlias = antiAlias
+			for i, tt := range []float64{0, 1} {
+				frame, err := job.RenderFrame(0, tt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := imageDifference(frame, job.Images[i], 1); n > 0 {
+					t.Errorf("method %d, antialias %v: t=%g differs from image %d in %d pixels", method, antiAlias, tt, i, n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/fogleman/delaunay"
+)
+
+// Lattice is a regular grid of control vertices laid over an image, for mesh
+// warping. Points holds Rows x Cols vertices in row major order. Vertices
+// must stay ordered: x increasing along each row, y increasing down each
+// column.
+type Lattice struct {
+	Rows, Cols int
+	Points     []delaunay.Point
+}
+
+// NewLattice creates an evenly spaced lattice covering bounds, with vertices
+// on the image edges
+func NewLattice(bounds image.Rectangle, rows, cols int) Lattice {
+	l := Lattice{Rows: rows, Cols: cols, Points: make([]delaunay.Point, 0, rows*cols)}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			l.Points = append(l.Points, delaunay.Point{
+				X: float64(bounds.Min.X) + float64(c*(bounds.Dx()-1))/float64(cols-1),
+				Y: float64(bounds.Min.Y) + float64(r*(bounds.Dy()-1))/float64(rows-1),
+			})
+		}
+	}
+	return l
+}
+
+// At returns the vertex at row r, column c
+func (l Lattice) At(r, c int) delaunay.Point {
+	return l.Points[r*l.Cols+c]
+}
+
+// validate checks the lattice has the right number of vertices, and doesn't
+// fold over itself
+func (l Lattice) validate() error {
+	if l.Rows < 2 || l.Cols < 2 {
+		return fmt.Errorf("lattice must be at least 2x2, have %dx%d", l.Rows, l.Cols)
+	}
+	if len(l.Points) != l.Rows*l.Cols {
+		return fmt.Errorf("%dx%d lattice needs %d points, have %d", l.Rows, l.Cols, l.Rows*l.Cols, len(l.Points))
+	}
+	for r := 0; r < l.Rows; r++ {
+		for c := 0; c < l.Cols; c++ {
+			if c > 0 && l.At(r, c).X <= l.At(r, c-1).X {
+				return fmt.Errorf("lattice folds horizontally at row %d, column %d", r, c)
+			}
+			if r > 0 && l.At(r, c).Y <= l.At(r-1, c).Y {
+				return fmt.Errorf("lattice folds vertically at row %d, column %d", r, c)
+			}
+		}
+	}
+	return nil
+}
+
+// lerpLattice linearly interpolates between two lattices of the same size
+func lerpLattice(from, to Lattice, t float64) Lattice {
+	return Lattice{Rows: from.Rows, Cols: from.Cols, Points: lerpPoints(from.Points, to.Points, t)}
+}
+
+// monotoneSpline is a piecewise cubic Hermite interpolant with Fritsch-Carlson
+// slopes, so it doesn't overshoot between knots. Outside the knots it
+// extrapolates linearly.
+type monotoneSpline struct {
+	x, y, m []float64
+}
+
+// newMonotoneSpline fits a spline through (x[i], y[i]). Knots that don't
+// strictly increase in x are dropped.
+func newMonotoneSpline(x, y []float64) monotoneSpline {
+	var s monotoneSpline
+	for i := range x {
+		if len(s.x) > 0 && x[i] <= s.x[len(s.x)-1] {
+			continue
+		}
+		s.x = append(s.x, x[i])
+		s.y = append(s.y, y[i])
+	}
+	n := len(s.x)
+	s.m = make([]float64, n)
+	if n < 2 {
+		return s
+	}
+
+	delta := make([]float64, n-1)
+	for i := range delta {
+		delta[i] = (s.y[i+1] - s.y[i]) / (s.x[i+1] - s.x[i])
+	}
+	s.m[0], s.m[n-1] = delta[0], delta[n-2]
+	for i := 1; i < n-1; i++ {
+		if delta[i-1]*delta[i] <= 0 {
+			s.m[i] = 0 // Local extremum; keep it flat
+		} else {
+			s.m[i] = (delta[i-1] + delta[i]) / 2
+		}
+	}
+	for i := range delta {
+		if delta[i] == 0 {
+			s.m[i], s.m[i+1] = 0, 0
+			continue
+		}
+		// Limit the slopes to the circle of radius 3, which guarantees
+		// monotonicity on this interval
+		a, b := s.m[i]/delta[i], s.m[i+1]/delta[i]
+		if h := a*a + b*b; h > 9 {
+			tau := 3 / math.Sqrt(h)
+			s.m[i] = tau * a * delta[i]
+			s.m[i+1] = tau * b * delta[i]
+		}
+	}
+	return s
+}
+
+func (s monotoneSpline) at(v float64) float64 {
+	n := len(s.x)
+	switch {
+	case n == 0:
+		return v
+	case n == 1:
+		return s.y[0]
+	case v <= s.x[0]:
+		return s.y[0] + (v-s.x[0])*s.m[0]
+	case v >= s.x[n-1]:
+		return s.y[n-1] + (v-s.x[n-1])*s.m[n-1]
+	}
+	i := sort.SearchFloat64s(s.x, v) - 1
+	h := s.x[i+1] - s.x[i]
+	t := (v - s.x[i]) / h
+	t2, t3 := t*t, t*t*t
+	return (2*t3-3*t2+1)*s.y[i] + (t3-2*t2+t)*h*s.m[i] + (-2*t3+3*t2)*s.y[i+1] + (t3-t2)*h*s.m[i+1]
+}
+
+// WarpImageMesh warps srcImg with Wolberg's two-pass separable mesh warp.
+// dstLattice is the lattice in the geometry of the output image, and
+// srcLattice the matching lattice in srcImg. The first pass resamples each
+// row to move the lattice columns into place, and the second resamples each
+// column to move the rows. Rows and columns are spread over the threads in
+// opts.
+func WarpImageMesh(srcImg *image.NRGBA, dstLattice, srcLattice Lattice, opts WarpOptions) (*image.NRGBA, error) {
+	if dstLattice.Rows != srcLattice.Rows || dstLattice.Cols != srcLattice.Cols {
+		return nil, fmt.Errorf("source and destination lattices must be the same size")
+	}
+	if err := srcLattice.validate(); err != nil {
+		return nil, fmt.Errorf("source %w", err)
+	}
+	if err := dstLattice.validate(); err != nil {
+		return nil, fmt.Errorf("destination %w", err)
+	}
+	rows, cols := srcLattice.Rows, srcLattice.Cols
+	sampler := opts.sampler()
+	b := srcImg.Bounds()
+
+	// Pass 1: the intermediate lattice has the destination's x and the
+	// source's y. Spline each lattice column as x(y) in both.
+	srcColumns := make([]monotoneSpline, cols)
+	midColumns := make([]monotoneSpline, cols)
+	for c := 0; c < cols; c++ {
+		ys, srcXs, midXs := make([]float64, rows), make([]float64, rows), make([]float64, rows)
+		for r := 0; r < rows; r++ {
+			ys[r] = srcLattice.At(r, c).Y
+			srcXs[r] = srcLattice.At(r, c).X
+			midXs[r] = dstLattice.At(r, c).X
+		}
+		srcColumns[c] = newMonotoneSpline(ys, srcXs)
+		midColumns[c] = newMonotoneSpline(ys, midXs)
+	}
+	pool := opts.workers()
+	mid := image.NewNRGBA(b)
+	pool.forEach(opts.context(), b.Dy(), func(i int) {
+		y := b.Min.Y + i
+		srcKnots, midKnots := make([]float64, cols), make([]float64, cols)
+		for c := 0; c < cols; c++ {
+			srcKnots[c] = srcColumns[c].at(float64(y))
+			midKnots[c] = midColumns[c].at(float64(y))
+		}
+		row := newMonotoneSpline(midKnots, srcKnots)
+		off := mid.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			col := sampler.Sample(srcImg, row.at(float64(x)), float64(y), opts.Border)
+			mid.Pix[off+0], mid.Pix[off+1], mid.Pix[off+2], mid.Pix[off+3] = col.R, col.G, col.B, col.A
+			off += 4
+		}
+	})
+
+	// Pass 2: spline each lattice row as y(x) in the intermediate and the
+	// destination, both of which have the destination's x
+	midRows := make([]monotoneSpline, rows)
+	dstRows := make([]monotoneSpline, rows)
+	for r := 0; r < rows; r++ {
+		xs, midYs, dstYs := make([]float64, cols), make([]float64, cols), make([]float64, cols)
+		for c := 0; c < cols; c++ {
+			xs[c] = dstLattice.At(r, c).X
+			midYs[c] = srcLattice.At(r, c).Y
+			dstYs[c] = dstLattice.At(r, c).Y
+		}
+		midRows[r] = newMonotoneSpline(xs, midYs)
+		dstRows[r] = newMonotoneSpline(xs, dstYs)
+	}
+	dstImg := image.NewNRGBA(b)
+	pool.forEach(opts.context(), b.Dx(), func(i int) {
+		x := b.Min.X + i
+		midKnots, dstKnots := make([]float64, rows), make([]float64, rows)
+		for r := 0; r < rows; r++ {
+			midKnots[r] = midRows[r].at(float64(x))
+			dstKnots[r] = dstRows[r].at(float64(x))
+		}
+		column := newMonotoneSpline(dstKnots, midKnots)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			col := sampler.Sample(mid, float64(x), column.at(float64(y)), opts.Border)
+			off := dstImg.PixOffset(x, y)
+			dstImg.Pix[off+0], dstImg.Pix[off+1], dstImg.Pix[off+2], dstImg.Pix[off+3] = col.R, col.G, col.B, col.A
+		}
+	})
+	return dstImg, nil
+}
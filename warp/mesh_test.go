@@ -0,0 +1,31 @@
+package warp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWarpImageMeshIdentity(t *testing.T) {
+	srcImg := createTestImage(120, 90)
+	lattice := NewLattice(srcImg.Bounds(), 4, 5)
+
+	dst, err := WarpImageMesh(srcImg, lattice, lattice, WarpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Pix, srcImg.Pix) {
+		t.Error("identity lattice changed the image")
+	}
+}
+
+func TestWarpImageMeshRejectsFolds(t *testing.T) {
+	srcImg := createTestImage(120, 90)
+	lattice := NewLattice(srcImg.Bounds(), 3, 3)
+	folded := NewLattice(srcImg.Bounds(), 3, 3)
+	// Drag the centre vertex past its right hand neighbour
+	folded.Points[4].X = 130
+
+	if _, err := WarpImageMesh(srcImg, folded, lattice, WarpOptions{}); err == nil {
+		t.Error("expected an error for a folded lattice")
+	}
+}
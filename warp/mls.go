@@ -0,0 +1,131 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/delaunay"
+)
+
+// MLSVariant selects the family of transforms that moving least squares
+// fits around each pixel
+type MLSVariant int
+
+const (
+	// MLSRigid allows rotation only, which avoids shearing when few points
+	// are placed. It is the default.
+	MLSRigid MLSVariant = iota
+	// MLSSimilarity allows rotation and uniform scaling
+	MLSSimilarity
+	// MLSAffine allows shearing and non-uniform scaling
+	MLSAffine
+)
+
+// MLSVariantByName looks up an MLS variant from its command line/json name
+func MLSVariantByName(name string) (MLSVariant, error) {
+	switch name {
+	case "", "rigid":
+		return MLSRigid, nil
+	case "similarity":
+		return MLSSimilarity, nil
+	case "affine":
+		return MLSAffine, nil
+	default:
+		return 0, fmt.Errorf("unknown MLS variant: %q", name)
+	}
+}
+
+// mlsMapping returns the moving least squares deformation (Schaefer et al.
+// 2006) taking each ctrl point to the matching target point. Point weights are
+// recomputed on each pass rather than stored, so the mapping is safe to call
+// concurrently.
+func mlsMapping(ctrl, target []delaunay.Point, variant MLSVariant) func(x, y float64) (float64, float64) {
+	weight := func(p delaunay.Point, x, y float64) float64 {
+		dx, dy := p.X-x, p.Y-y
+		return 1 / (dx*dx + dy*dy)
+	}
+	return func(x, y float64) (float64, float64) {
+		// Weighted centroids of both point sets, with weights 1/d^2
+		var total, pX, pY, qX, qY float64
+		for i, p := range ctrl {
+			dx, dy := p.X-x, p.Y-y
+			d := dx*dx + dy*dy
+			if d < 1e-12 {
+				return target[i].X, target[i].Y
+			}
+			w := 1 / d
+			total += w
+			pX += w * p.X
+			pY += w * p.Y
+			qX += w * target[i].X
+			qY += w * target[i].Y
+		}
+		if total == 0 {
+			return x, y
+		}
+		pX, pY, qX, qY = pX/total, pY/total, qX/total, qY/total
+		vX, vY := x-pX, y-pY
+
+		switch variant {
+		case MLSAffine:
+			// M = (sum w p^T p)^-1 (sum w p^T q), using row vectors
+			var A, B [2][2]float64
+			for i, p := range ctrl {
+				w := weight(p, x, y)
+				phX, phY := p.X-pX, p.Y-pY
+				qhX, qhY := target[i].X-qX, target[i].Y-qY
+				A[0][0] += w * phX * phX
+				A[0][1] += w * phX * phY
+				A[1][1] += w * phY * phY
+				B[0][0] += w * phX * qhX
+				B[0][1] += w * phX * qhY
+				B[1][0] += w * phY * qhX
+				B[1][1] += w * phY * qhY
+			}
+			A[1][0] = A[0][1]
+			Ainv, ok := inv2x2(A)
+			if !ok {
+				// All the nearby weight is on collinear points; fall back to translation
+				return x - pX + qX, y - pY + qY
+			}
+			// (v A^-1) B
+			uX := vX*Ainv[0][0] + vY*Ainv[1][0]
+			uY := vX*Ainv[0][1] + vY*Ainv[1][1]
+			return uX*B[0][0] + uY*B[1][0] + qX, uX*B[0][1] + uY*B[1][1] + qY
+
+		default:
+			// Similarity & rigid both reduce to a rotation and scale, given by
+			// the weighted dot (a) and cross (b) products of the point pairs
+			var a, b, mu float64
+			for i, p := range ctrl {
+				w := weight(p, x, y)
+				phX, phY := p.X-pX, p.Y-pY
+				qhX, qhY := target[i].X-qX, target[i].Y-qY
+				a += w * (phX*qhX + phY*qhY)
+				b += w * (phX*qhY - phY*qhX)
+				mu += w * (phX*phX + phY*phY)
+			}
+			if variant == MLSRigid {
+				mu = math.Hypot(a, b)
+			}
+			if mu < 1e-12 {
+				return x - pX + qX, y - pY + qY
+			}
+			return (a*vX-b*vY)/mu + qX, (b*vX+a*vY)/mu + qY
+		}
+	}
+}
+
+// WarpImageMLS warps srcImg with a moving least squares deformation.
+// dstPoints are the control points in the geometry of the output image, and
+// srcPoints the matching points in srcImg. The rigid variant avoids the
+// shearing a piecewise affine warp gives when only a few points are placed.
+func WarpImageMLS(srcImg *image.NRGBA, dstPoints, srcPoints []delaunay.Point, variant MLSVariant, opts WarpOptions) (*image.NRGBA, error) {
+	if len(dstPoints) != len(srcPoints) {
+		return nil, fmt.Errorf("source and destination point lists must have the same length")
+	}
+	dstImg := image.NewNRGBA(srcImg.Bounds())
+	warpInverse(srcImg, dstImg, mlsMapping(dstPoints, srcPoints, variant), opts)
+	return dstImg, nil
+}
@@ -0,0 +1,59 @@
+package warp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+var mlsCtrl = []delaunay.Point{{X: 10, Y: 10}, {X: 50, Y: 12}, {X: 30, Y: 40}, {X: 8, Y: 45}, {X: 55, Y: 50}}
+
+func TestMLSInterpolatesControlPoints(t *testing.T) {
+	target := []delaunay.Point{{X: 12, Y: 9}, {X: 47, Y: 18}, {X: 33, Y: 37}, {X: 5, Y: 49}, {X: 60, Y: 52}}
+	for _, variant := range []MLSVariant{MLSAffine, MLSSimilarity, MLSRigid} {
+		mapping := mlsMapping(mlsCtrl, target, variant)
+		for i, p := range mlsCtrl {
+			x, y := mapping(p.X, p.Y)
+			if math.Abs(x-target[i].X) > 1e-9 || math.Abs(y-target[i].Y) > 1e-9 {
+				t.Errorf("variant %d: control point %v mapped to (%g, %g), want %v", variant, p, x, y, target[i])
+			}
+		}
+	}
+}
+
+func TestMLSRigidPreservesLengthsUnderRotation(t *testing.T) {
+	// Rotating every control point about a centre is itself a rigid
+	// transform, so the rigid fit everywhere is that rotation
+	sin, cos := math.Sincos(0.4)
+	rotate := func(p delaunay.Point) delaunay.Point {
+		d := sub(p, delaunay.Point{X: 30, Y: 30})
+		return delaunay.Point{X: 30 + d.X*cos - d.Y*sin, Y: 30 + d.X*sin + d.Y*cos}
+	}
+	target := make([]delaunay.Point, len(mlsCtrl))
+	for i, p := range mlsCtrl {
+		target[i] = rotate(p)
+	}
+	mapping := mlsMapping(mlsCtrl, target, MLSRigid)
+
+	a, b := delaunay.Point{X: 20, Y: 25}, delaunay.Point{X: 42, Y: 31}
+	ax, ay := mapping(a.X, a.Y)
+	bx, by := mapping(b.X, b.Y)
+	if got, want := math.Hypot(bx-ax, by-ay), math.Hypot(b.X-a.X, b.Y-a.Y); math.Abs(got-want) > 1e-9 {
+		t.Errorf("distance %g after rotation, want %g", got, want)
+	}
+	if want := rotate(a); math.Abs(ax-want.X) > 1e-9 || math.Abs(ay-want.Y) > 1e-9 {
+		t.Errorf("%v mapped to (%g, %g), want %v", a, ax, ay, want)
+	}
+}
+
+func TestMLSVariantDefaultIsRigid(t *testing.T) {
+	// A job built in Go warps the same as one loaded without a variant
+	variant, err := MLSVariantByName("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variant != MLSRigid || (WarpJob{}).MLSVariant != MLSRigid {
+		t.Errorf("default variants are %d by name and %d in Go, want rigid", variant, (WarpJob{}).MLSVariant)
+	}
+}
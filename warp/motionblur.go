@@ -0,0 +1,131 @@
+package warp
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+)
+
+// MotionBlur averages several renders spread over the time a virtual shutter
+// is open, so fast moving parts of the morph blur rather than strobe
+type MotionBlur struct {
+	Samples int // Sub-frames averaged per frame. 0 or 1 disables motion blur
+
+	// Shutter is the shutter angle in degrees: 360 exposes each frame for the
+	// whole time until the next, 180 for half of it. If 0, uses 180.
+	Shutter float64
+}
+
+// MotionBlurSaveFormat is the json form of a MotionBlur
+type MotionBlurSaveFormat struct {
+	Samples int     `json:"samples"`
+	Shutter float64 `json:"shutter,omitempty"`
+}
+
+// MotionBlur converts the saved description into a MotionBlur
+func (m *MotionBlurSaveFormat) MotionBlur() (MotionBlur, error) {
+	if m.Samples < 0 || m.Shutter < 0 || m.Shutter > 360 {
+		return MotionBlur{}, fmt.Errorf("invalid motion blur: %d samples, %g degree shutter", m.Samples, m.Shutter)
+	}
+	return MotionBlur{Samples: m.Samples, Shutter: m.Shutter}, nil
+}
+
+func (m MotionBlur) shutter() float64 {
+	if m.Shutter <= 0 {
+		return 180
+	}
+	return m.Shutter
+}
+
+// blurredFrameAt is frameAt with motion blur. interval is the linear time
+// between frames of the transition, and seed varies the jitter from frame to
+// frame so it doesn't form a fixed pattern. Cancelling ctx stops between, and
+// part way through, the sub-frames.
+func (w *WarpJob) blurredFrameAt(ctx context.Context, transition int, t, interval float64, triangles []int, seed uint64) (*image.NRGBA, error) {
+	samples := w.MotionBlur.Samples
+	if samples <= 1 || interval <= 0 {
+		return w.frameAt(ctx, transition, t, triangles)
+	}
+
+	// The shutter is open for an interval centred on t. Each sample is
+	// jittered within its own equal slice of it, so they cover it evenly
+	// without the banding of fixed steps.
+	open := interval * w.MotionBlur.shutter() / 360
+	start := t - open/2
+	rng := rand.New(rand.NewPCG(seed, uint64(transition)))
+	var acc *accumulator
+	for i := 0; i < samples; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		st := start + (float64(i)+rng.Float64())/float64(samples)*open
+		img, err := w.frameAt(ctx, transition, math.Max(0, math.Min(1, st)), triangles)
+		if err != nil {
+			return nil, err
+		}
+		if acc == nil {
+			acc = newAccumulator(img.Bounds())
+		}
+		acc.add(img)
+	}
+	return acc.resolve(), nil
+}
+
+// frameInterval returns the linear time between the frames of a transition
+// with the given number of frames
+func frameInterval(frames int) float64 {
+	if frames <= 1 {
+		return 0
+	}
+	return 1 / float64(frames-1)
+}
+
+// accumulator sums images in floating point, premultiplied by alpha, so
+// averaging many of them doesn't lose precision or darken transparent edges
+type accumulator struct {
+	rect  image.Rectangle
+	pix   []float32 // Premultiplied R, G, B, A per pixel
+	count int
+}
+
+func newAccumulator(rect image.Rectangle) *accumulator {
+	return &accumulator{rect: rect, pix: make([]float32, rect.Dx()*rect.Dy()*4)}
+}
+
+func (a *accumulator) add(img *image.NRGBA) {
+	i := 0
+	for y := a.rect.Min.Y; y < a.rect.Max.Y; y++ {
+		p := img.Pix[img.PixOffset(a.rect.Min.X, y):]
+		for x := 0; x < a.rect.Dx()*4; x += 4 {
+			alpha := float32(p[x+3])
+			a.pix[i+0] += float32(p[x+0]) * alpha
+			a.pix[i+1] += float32(p[x+1]) * alpha
+			a.pix[i+2] += float32(p[x+2]) * alpha
+			a.pix[i+3] += alpha
+			i += 4
+		}
+	}
+	a.count++
+}
+
+// resolve returns the average of the added images
+func (a *accumulator) resolve() *image.NRGBA {
+	dst := image.NewNRGBA(a.rect)
+	i := 0
+	for y := a.rect.Min.Y; y < a.rect.Max.Y; y++ {
+		p := dst.Pix[dst.PixOffset(a.rect.Min.X, y):]
+		for x := 0; x < a.rect.Dx()*4; x += 4 {
+			alpha := a.pix[i+3]
+			if alpha > 0 {
+				p[x+0] = clampChannel(float64(a.pix[i+0] / alpha))
+				p[x+1] = clampChannel(float64(a.pix[i+1] / alpha))
+				p[x+2] = clampChannel(float64(a.pix[i+2] / alpha))
+				p[x+3] = clampChannel(float64(alpha / float32(a.count)))
+			}
+			i += 4
+		}
+	}
+	return dst
+}
@@ -0,0 +1,131 @@
+package warp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAccumulatorAverages(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 1)
+	black, white := image.NewNRGBA(rect), image.NewNRGBA(rect)
+	black.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	white.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
+	// A transparent sample lowers the alpha, but doesn't darken the colour
+	black.SetNRGBA(1, 0, color.NRGBA{0, 0, 0, 0})
+	white.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 255})
+
+	acc := newAccumulator(rect)
+	acc.add(black)
+	acc.add(white)
+	avg := acc.resolve()
+	if c := avg.NRGBAAt(0, 0); c.R != 128 || c.A != 255 {
+		t.Errorf("opaque average = %v, want R=128 A=255", c)
+	}
+	if c := avg.NRGBAAt(1, 0); c.R != 255 || c.A != 128 {
+		t.Errorf("transparent average = %v, want R=255 A=128", c)
+	}
+}
+
+func TestMotionBlurBlendsNeighbouringTimes(t *testing.T) {
+	job := testJob()
+	if _, err := job.setup(); err != nil {
+		t.Fatal(err)
+	}
+	triangles, err := job.transitionTriangles(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharp, err := job.blurredFrameAt(context.Background(), 0, 0.5, 0.5, triangles, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.MotionBlur = MotionBlur{Samples: 8, Shutter: 360}
+	blurred, err := job.blurredFrameAt(context.Background(), 0, 0.5, 0.5, triangles, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := 0
+	for i := range sharp.Pix {
+		if sharp.Pix[i] != blurred.Pix[i] {
+			diff++
+		}
+	}
+	if diff == 0 {
+		t.Error("motion blur had no effect")
+	}
+}
+
+func TestMotionBlurHeldFramesStill(t *testing.T) {
+	job := pairJob(MethodTriangles)
+	job.Sequence = Sequence{Hold: 3}
+	job.MotionBlur = MotionBlur{Samples: 4}
+	keyframes := make([]*image.NRGBA, 2)
+	for i, tt := range []float64{0, 1} {
+		var err error
+		if keyframes[i], err = job.RenderFrame(0, tt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var frames []*image.NRGBA
+	for info, img := range job.Frames(context.Background(), 5) {
+		if info.Err != nil {
+			t.Fatal(info.Err)
+		}
+		frames = append(frames, img)
+	}
+	// Each image is held for 3 frames, around the 3 moving ones between them
+	if len(frames) != 9 {
+		t.Fatalf("got %d frames, want 9", len(frames))
+	}
+	for _, held := range [][]int{{0, 1, 2}, {6, 7, 8}} {
+		keyframe := keyframes[held[0]/6]
+		for _, i := range held {
+			if !bytes.Equal(frames[i].Pix, keyframe.Pix) {
+				t.Errorf("held frame %d differs from its unblurred image", i)
+			}
+		}
+	}
+}
+
+// cancellingSampler cancels rendering the first time it is used, and counts
+// the pixels sampled after that
+type cancellingSampler struct {
+	cancel context.CancelFunc
+	count  atomic.Int64
+}
+
+func (s *cancellingSampler) Sample(img *image.NRGBA, x, y float64, border Border) color.NRGBA {
+	s.cancel()
+	s.count.Add(1)
+	return NearestSampler{}.Sample(img, x, y, border)
+}
+
+func TestMotionBlurCancelledMidFrame(t *testing.T) {
+	job := testJob()
+	job.ThreadCount = 1
+	job.MotionBlur = MotionBlur{Samples: 8}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sampler := &cancellingSampler{cancel: cancel}
+	job.Sampler = sampler
+	triangles, err := job.transitionTriangles(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hold the only worker, as Frames does, so the bands are warped in turn
+	job.cache.pool <- struct{}{}
+	if _, err := job.blurredFrameAt(ctx, 0, 0.5, 0.5, triangles, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	// Only the band being warped when it was cancelled is finished, rather
+	// than all 8 sub-frames of both images
+	if n, pixels := sampler.count.Load(), int64(64*48); n >= pixels {
+		t.Errorf("sampled %d pixels after cancelling, want less than one warp's %d", n, pixels)
+	}
+}
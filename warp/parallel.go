@@ -0,0 +1,64 @@
+package warp
+
+import (
+	"context"
+	"image"
+	"sync"
+	"sync/atomic"
+)
+
+// tileRows is the height, in pixels, of the bands a warp is split into when
+// rendering a single image across several threads
+const tileRows = 32
+
+// workerPool is a budget of threads, shared between concurrently rendered
+// frames and the tiles within each frame. Each running goroutine holds one
+// token; extra tiles only get their own goroutine when a token is free, so
+// the total never exceeds the pool's capacity.
+type workerPool chan struct{}
+
+// forEach calls fn for each index 0 to n-1 and waits for them all to finish.
+// The calling goroutine always does some of the work itself, and is helped
+// by as many extra goroutines as the pool has free tokens. Once ctx is
+// cancelled the remaining indices are skipped.
+func (p workerPool) forEach(ctx context.Context, n int, fn func(i int)) {
+	var next atomic.Int64
+	work := func() {
+		for {
+			i := int(next.Add(1)) - 1
+			if i >= n || ctx.Err() != nil {
+				return
+			}
+			fn(i)
+		}
+	}
+
+	var helpers sync.WaitGroup
+spawn:
+	for i := 1; i < n; i++ {
+		select {
+		case p <- struct{}{}:
+			helpers.Go(func() {
+				defer func() { <-p }()
+				work()
+			})
+		default:
+			break spawn
+		}
+	}
+	work()
+	helpers.Wait()
+}
+
+// bands splits rect into tileRows high bands for forEach. Without any
+// threads to share the work, it is left whole.
+func (p workerPool) bands(rect image.Rectangle) []image.Rectangle {
+	if cap(p) == 0 {
+		return []image.Rectangle{rect}
+	}
+	var bands []image.Rectangle
+	for y := rect.Min.Y; y < rect.Max.Y; y += tileRows {
+		bands = append(bands, image.Rect(rect.Min.X, y, rect.Max.X, min(y+tileRows, rect.Max.Y)))
+	}
+	return bands
+}
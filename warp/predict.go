@@ -0,0 +1,131 @@
+package warp
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/fogleman/delaunay"
+)
+
+// predictNeighbours is the number of nearest correspondences PredictPoint
+// fits a local affine transform to, outside the mesh
+const predictNeighbours = 6
+
+// PredictPoint predicts where p on one image lies on another, from the
+// existing correspondences between them: from[i] on the first image matches
+// to[i] on the second. Inside the Delaunay mesh of from, p is interpolated
+// through the triangle containing it, so it follows the same warp the
+// triangles method applies. Outside it, an affine transform is fitted to the
+// nearest correspondences, weighted towards the closest. With fewer than
+// three correspondences p is shifted by their (weighted) displacement, and
+// with none it is returned unchanged.
+func PredictPoint(from, to []delaunay.Point, p delaunay.Point) delaunay.Point {
+	n := min(len(from), len(to))
+	from, to = from[:n], to[:n]
+	if n == 0 {
+		return p
+	}
+	if n >= 3 {
+		if predicted, ok := predictBarycentric(from, to, p); ok {
+			return predicted
+		}
+		if predicted, ok := predictAffine(from, to, p); ok {
+			return predicted
+		}
+	}
+	return predictTranslation(from, to, p)
+}
+
+// predictBarycentric maps p through the triangle of the Delaunay mesh of from
+// containing it, if there is one
+func predictBarycentric(from, to []delaunay.Point, p delaunay.Point) (delaunay.Point, bool) {
+	triangulation, err := delaunay.Triangulate(from)
+	if err != nil {
+		return delaunay.Point{}, false
+	}
+	const epsilon = 1e-9
+	ts := triangulation.Triangles
+	for i := 0; i+2 < len(ts); i += 3 {
+		a, b, c := from[ts[i]], from[ts[i+1]], from[ts[i+2]]
+		det := (b.Y-c.Y)*(a.X-c.X) + (c.X-b.X)*(a.Y-c.Y)
+		if math.Abs(det) < epsilon {
+			continue
+		}
+		l1 := ((b.Y-c.Y)*(p.X-c.X) + (c.X-b.X)*(p.Y-c.Y)) / det
+		l2 := ((c.Y-a.Y)*(p.X-c.X) + (a.X-c.X)*(p.Y-c.Y)) / det
+		l3 := 1 - l1 - l2
+		if l1 < -epsilon || l2 < -epsilon || l3 < -epsilon {
+			continue
+		}
+		ta, tb, tc := to[ts[i]], to[ts[i+1]], to[ts[i+2]]
+		return delaunay.Point{
+			X: l1*ta.X + l2*tb.X + l3*tc.X,
+			Y: l1*ta.Y + l2*tb.Y + l3*tc.Y,
+		}, true
+	}
+	return delaunay.Point{}, false
+}
+
+// neighbourWeight weights a correspondence by its distance from the point
+// being predicted, so the closest dominate
+func neighbourWeight(a, p delaunay.Point) float64 {
+	d := sub(a, p)
+	return 1 / (d.X*d.X + d.Y*d.Y + 1)
+}
+
+// predictAffine fits an affine transform to the correspondences nearest p by
+// weighted least squares, and applies it to p. It fails if they are collinear.
+func predictAffine(from, to []delaunay.Point, p delaunay.Point) (delaunay.Point, bool) {
+	nearest := make([]int, len(from))
+	for i := range nearest {
+		nearest[i] = i
+	}
+	slices.SortFunc(nearest, func(i, j int) int {
+		return cmp.Compare(neighbourWeight(from[j], p), neighbourWeight(from[i], p))
+	})
+	nearest = nearest[:min(len(nearest), predictNeighbours)]
+
+	// Normal equations for [x-p.X, y-p.Y, 1] -> to, centred on p so the
+	// prediction is just the constant term
+	m := [][]float64{make([]float64, 5), make([]float64, 5), make([]float64, 5)}
+	for _, i := range nearest {
+		w := neighbourWeight(from[i], p)
+		d := sub(from[i], p)
+		v := [3]float64{d.X, d.Y, 1}
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				m[r][c] += w * v[r] * v[c]
+			}
+			m[r][3] += w * v[r] * to[i].X
+			m[r][4] += w * v[r] * to[i].Y
+		}
+	}
+	// Reject nearly collinear neighbours, which leave the fit unconstrained
+	// across them
+	xx := m[0][0] - m[0][2]*m[0][2]/m[2][2]
+	yy := m[1][1] - m[1][2]*m[1][2]/m[2][2]
+	xy := m[0][1] - m[0][2]*m[1][2]/m[2][2]
+	if spread := xx + yy; spread <= 0 || xx*yy-xy*xy < 1e-6*spread*spread {
+		return delaunay.Point{}, false
+	}
+	if err := solveLinear(m); err != nil {
+		return delaunay.Point{}, false
+	}
+	return delaunay.Point{X: m[2][3], Y: m[2][4]}, true
+}
+
+// predictTranslation shifts p by the weighted average displacement of the
+// correspondences
+func predictTranslation(from, to []delaunay.Point, p delaunay.Point) delaunay.Point {
+	var shift delaunay.Point
+	total := 0.0
+	for i := range from {
+		w := neighbourWeight(from[i], p)
+		d := sub(to[i], from[i])
+		shift.X += w * d.X
+		shift.Y += w * d.Y
+		total += w
+	}
+	return delaunay.Point{X: p.X + shift.X/total, Y: p.Y + shift.Y/total}
+}
@@ -0,0 +1,51 @@
+package warp
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+func TestPredictPointAffine(t *testing.T) {
+	// Under a global affine transform, prediction is exact inside and outside
+	// the mesh
+	transform := func(p delaunay.Point) delaunay.Point {
+		return delaunay.Point{X: 1.1*p.X + 0.2*p.Y + 15, Y: -0.1*p.X + 0.9*p.Y - 8}
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	var from, to []delaunay.Point
+	for i := 0; i < 12; i++ {
+		p := delaunay.Point{X: 50 + rng.Float64()*100, Y: 50 + rng.Float64()*100}
+		from = append(from, p)
+		to = append(to, transform(p))
+	}
+	for _, p := range []delaunay.Point{{X: 100, Y: 100}, {X: 10, Y: 20}, {X: 190, Y: 120}} {
+		got, want := PredictPoint(from, to, p), transform(p)
+		if math.Hypot(got.X-want.X, got.Y-want.Y) > 1e-6 {
+			t.Errorf("%v: predicted %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestPredictPointFewCorrespondences(t *testing.T) {
+	p := delaunay.Point{X: 30, Y: 40}
+	if got := PredictPoint(nil, nil, p); got != p {
+		t.Errorf("no correspondences: predicted %v, want %v", got, p)
+	}
+
+	from := []delaunay.Point{{X: 0, Y: 0}}
+	to := []delaunay.Point{{X: 5, Y: -3}}
+	if got := PredictPoint(from, to, p); math.Abs(got.X-35) > 1e-9 || math.Abs(got.Y-37) > 1e-9 {
+		t.Errorf("one correspondence: predicted %v, want (35, 37)", got)
+	}
+
+	// Collinear correspondences can't fix an affine transform, so fall back
+	// to their displacement
+	from = []delaunay.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 20, Y: 0}}
+	to = []delaunay.Point{{X: 2, Y: 2}, {X: 12, Y: 2}, {X: 22, Y: 2}}
+	if got := PredictPoint(from, to, p); math.Abs(got.X-32) > 1e-9 || math.Abs(got.Y-42) > 1e-9 {
+		t.Errorf("collinear correspondences: predicted %v, want (32, 42)", got)
+	}
+}
@@ -0,0 +1,106 @@
+package warp
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"runtime"
+	"slices"
+
+	"github.com/fogleman/delaunay"
+)
+
+// renderCache holds the setup shared by every frame of a job, so it is only
+// done once however the frames are rendered
+type renderCache struct {
+	// pool is the ThreadCount budget, shared by concurrently rendered frames
+	// and the bands within them
+	pool workerPool
+
+	triangles map[int]cachedTriangles // Triangulation of each transition
+}
+
+// cachedTriangles is a transition's triangulation, with the averaged points
+// it was built on so it can be rebuilt if they are edited
+type cachedTriangles struct {
+	points    []delaunay.Point
+	triangles []int
+}
+
+// setup validates the job, and prepares the shared render state on first
+// use. The job is validated on every call, as it may have been edited since
+// the last, but it must not be changed while frames are rendering.
+func (w *WarpJob) setup() (*renderCache, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	w.cacheMutex.Lock()
+	defer w.cacheMutex.Unlock()
+	if w.cache == nil {
+		if w.ThreadCount <= 0 {
+			w.ThreadCount = runtime.NumCPU()
+		}
+		w.cache = &renderCache{
+			pool:      make(workerPool, w.ThreadCount),
+			triangles: make(map[int]cachedTriangles),
+		}
+	}
+	return w.cache, nil
+}
+
+// transitionTriangles returns the triangulation shared by every frame of the
+// morph from Images[transition] to the next image, for MethodTriangles.
+// Both images of the pair use it, built on their averaged points so neither
+// layout is favoured. It is rebuilt if the points have changed since it was
+// cached.
+func (w *WarpJob) transitionTriangles(transition int) ([]int, error) {
+	if w.Method != MethodTriangles {
+		return nil, nil
+	}
+	cache, err := w.setup()
+	if err != nil {
+		return nil, err
+	}
+	points := w.trajectoryPoints(w.ImagePoints, transition, 0.5)
+	w.cacheMutex.Lock()
+	cached, ok := cache.triangles[transition]
+	w.cacheMutex.Unlock()
+	if ok && slices.Equal(cached.points, points) {
+		return cached.triangles, nil
+	}
+
+	triangles, err := w.triangulate(transition, 0.5)
+	if err != nil {
+		return nil, err
+	}
+	w.cacheMutex.Lock()
+	cache.triangles[transition] = cachedTriangles{points: points, triangles: triangles}
+	w.cacheMutex.Unlock()
+	return triangles, nil
+}
+
+// RenderFrame renders a single frame of the morph from Images[transition] to
+// the next image (wrapping back to the first for LoopWrap), at linear time t
+// (0.0 - 1.0) through the transition. The transition's easing and schedules
+// are applied as they are by Frames. The triangulation is cached until the
+// points change, so scrubbing back and forth through a transition only pays
+// for the warps.
+func (w *WarpJob) RenderFrame(transition int, t float64) (*image.NRGBA, error) {
+	cache, err := w.setup()
+	if err != nil {
+		return nil, err
+	}
+	if transition < 0 || transition >= w.transitionCount() {
+		return nil, fmt.Errorf("transition %d out of range, job has %d", transition, w.transitionCount())
+	}
+	triangles, err := w.transitionTriangles(transition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold a worker like a frame being rendered by Frames, so the two share
+	// the ThreadCount budget
+	cache.pool <- struct{}{}
+	defer func() { <-cache.pool }()
+	return w.frameAt(context.Background(), transition, t, triangles)
+}
@@ -0,0 +1,40 @@
+package warp
+
+import (
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+func TestTransitionTrianglesSharedByBothImages(t *testing.T) {
+	job := pairJob(MethodTriangles)
+	triangles, err := job.transitionTriangles(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The topology is built once on the averaged points, and must be valid
+	// for both images: no triangle degenerates, or folds over by flipping
+	// its orientation from one image to the other
+	area := func(points []delaunay.Point, i int) float64 {
+		a, b, c := points[triangles[i]], points[triangles[i+1]], points[triangles[i+2]]
+		return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+	}
+	bounds := job.Images[0].Bounds()
+	first, second := paddedPoints(bounds, job.ImagePoints[0]), paddedPoints(bounds, job.ImagePoints[1])
+	for i := 0; i < len(triangles); i += 3 {
+		a, b := area(first, i), area(second, i)
+		if a == 0 || b == 0 {
+			t.Errorf("triangle %d is degenerate: areas %g and %g", i/3, a, b)
+		} else if (a > 0) != (b > 0) {
+			t.Errorf("triangle %d folds over: areas %g and %g", i/3, a, b)
+		}
+	}
+	// A second call returns the cached triangulation
+	again, err := job.transitionTriangles(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &again[0] != &triangles[0] {
+		t.Error("triangulation was rebuilt rather than cached")
+	}
+}
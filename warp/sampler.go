@@ -0,0 +1,147 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Sampler reads a colour from an image at a floating point location, where
+// integer coordinates are pixel centres. Pixels outside the image are read
+// according to border.
+type Sampler interface {
+	Sample(img *image.NRGBA, x, y float64, border Border) color.NRGBA
+}
+
+// NearestSampler picks the closest pixel, without any filtering
+type NearestSampler struct{}
+
+// BilinearSampler interpolates linearly between the 4 surrounding pixels
+type BilinearSampler struct{}
+
+// BicubicSampler filters the surrounding 4x4 pixels using the Mitchell-Netravali
+// family of cubics. B=0, C=0.5 is Catmull-Rom, B=C=1/3 is Mitchell.
+type BicubicSampler struct {
+	B, C float64
+}
+
+// LanczosSampler filters the surrounding 6x6 pixels with a Lanczos-3 window
+type LanczosSampler struct{}
+
+var (
+	CatmullRom = BicubicSampler{B: 0, C: 0.5}
+	Mitchell   = BicubicSampler{B: 1.0 / 3, C: 1.0 / 3}
+)
+
+// SamplerByName looks up a sampler from its command line/json name
+func SamplerByName(name string) (Sampler, error) {
+	switch name {
+	case "", "bilinear":
+		return BilinearSampler{}, nil
+	case "nearest":
+		return NearestSampler{}, nil
+	case "bicubic", "catmull-rom":
+		return CatmullRom, nil
+	case "mitchell":
+		return Mitchell, nil
+	case "lanczos", "lanczos3":
+		return LanczosSampler{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sampler: %q", name)
+	}
+}
+
+func (NearestSampler) Sample(img *image.NRGBA, x, y float64, border Border) color.NRGBA {
+	return border.pixel(img, int(math.Round(x)), int(math.Round(y)))
+}
+
+func (BilinearSampler) Sample(img *image.NRGBA, x, y float64, border Border) color.NRGBA {
+	return sampleBilinear(img, x, y, border)
+}
+
+func (s BicubicSampler) Sample(img *image.NRGBA, x, y float64, border Border) color.NRGBA {
+	return sampleKernel(img, x, y, border, 2, s.weight)
+}
+
+// weight evaluates the Mitchell-Netravali cubic at distance d
+func (s BicubicSampler) weight(d float64) float64 {
+	B, C := s.B, s.C
+	d = math.Abs(d)
+	switch {
+	case d < 1:
+		return ((12-9*B-6*C)*d*d*d + (-18+12*B+6*C)*d*d + (6 - 2*B)) / 6
+	case d < 2:
+		return ((-B-6*C)*d*d*d + (6*B+30*C)*d*d + (-12*B-48*C)*d + (8*B + 24*C)) / 6
+	}
+	return 0
+}
+
+func (LanczosSampler) Sample(img *image.NRGBA, x, y float64, border Border) color.NRGBA {
+	return sampleKernel(img, x, y, border, 3, lanczos3)
+}
+
+func lanczos3(d float64) float64 {
+	d = math.Abs(d)
+	if d == 0 {
+		return 1
+	}
+	if d >= 3 {
+		return 0
+	}
+	pd := math.Pi * d
+	return 3 * math.Sin(pd) * math.Sin(pd/3) / (pd * pd)
+}
+
+// sampleKernel applies a separable filter kernel with the given radius (in
+// pixels) around (x,y). Weights are normalised, so windowed kernels that don't
+// sum to one don't change the image brightness. Colours are filtered
+// premultiplied by alpha, so transparent pixels don't bleed into their
+// neighbours.
+func sampleKernel(img *image.NRGBA, x, y float64, border Border, radius int, kernel func(float64) float64) color.NRGBA {
+	x0 := int(math.Floor(x)) - radius + 1
+	y0 := int(math.Floor(y)) - radius + 1
+	taps := 2 * radius
+
+	var wx, wy [6]float64
+	for i := 0; i < taps; i++ {
+		wx[i] = kernel(x - float64(x0+i))
+		wy[i] = kernel(y - float64(y0+i))
+	}
+
+	var r, g, b, a, total float64
+	for j := 0; j < taps; j++ {
+		for i := 0; i < taps; i++ {
+			w := wx[i] * wy[j]
+			if w == 0 {
+				continue
+			}
+			c := border.pixel(img, x0+i, y0+j)
+			wa := w * float64(c.A)
+			r += wa * float64(c.R)
+			g += wa * float64(c.G)
+			b += wa * float64(c.B)
+			a += wa
+			total += w
+		}
+	}
+	if total == 0 {
+		return border.pixel(img, int(math.Round(x)), int(math.Round(y)))
+	}
+	if a <= 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{clampChannel(r / a), clampChannel(g / a), clampChannel(b / a), clampChannel(a / total)}
+}
+
+// clampChannel rounds v into the 0-255 range. Filters with negative lobes can
+// overshoot near hard edges.
+func clampChannel(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,123 @@
+package warp
+
+import (
+	"fmt"
+	"slices"
+)
+
+// LoopMode selects how the end of the sequence leads back to its start
+type LoopMode int
+
+const (
+	// LoopNone plays the images through once
+	LoopNone LoopMode = iota
+	// LoopPingPong plays the images through, then back in reverse
+	// (boomerang), ending just before the first frame so it loops seamlessly
+	LoopPingPong
+	// LoopWrap adds a morph from the last image back to the first, ending just
+	// before the first frame so it loops seamlessly
+	LoopWrap
+)
+
+// LoopModeByName looks up a loop mode from its command line/json name
+func LoopModeByName(name string) (LoopMode, error) {
+	switch name {
+	case "", "none":
+		return LoopNone, nil
+	case "ping-pong", "boomerang":
+		return LoopPingPong, nil
+	case "wrap", "loop":
+		return LoopWrap, nil
+	default:
+		return 0, fmt.Errorf("unknown loop mode: %q", name)
+	}
+}
+
+// Sequence controls how the transitions are strung together
+type Sequence struct {
+	// Hold is the number of frames each image is shown for before morphing
+	// away from it. 0 or 1 shows it for a single frame.
+	Hold int
+	Loop LoopMode
+}
+
+// SequenceSaveFormat is the json form of a Sequence
+type SequenceSaveFormat struct {
+	Hold int    `json:"hold,omitempty"`
+	Loop string `json:"loop,omitempty"` // "none" (default), "ping-pong" or "wrap"
+}
+
+// Sequence converts the saved description into a Sequence
+func (s *SequenceSaveFormat) Sequence() (Sequence, error) {
+	loop, err := LoopModeByName(s.Loop)
+	if err != nil {
+		return Sequence{}, err
+	}
+	if s.Hold < 0 {
+		return Sequence{}, fmt.Errorf("invalid hold: %d frames", s.Hold)
+	}
+	return Sequence{Hold: s.Hold, Loop: loop}, nil
+}
+
+// transitionCount returns the number of transitions in the sequence, which
+// includes the morph from the last image back to the first for LoopWrap
+func (w *WarpJob) transitionCount() int {
+	if w.Sequence.Loop == LoopWrap {
+		return len(w.Images)
+	}
+	return len(w.Images) - 1
+}
+
+// nextImage returns the index of the image transition morphs to
+func (w *WarpJob) nextImage(transition int) int {
+	return (transition + 1) % len(w.Images)
+}
+
+// frameSequence returns every frame of the sequence in order, using
+// frameCount for transitions without their own timing. Consecutive
+// transitions share the frame showing the image between them, rather than
+// both rendering it.
+func (w *WarpJob) frameSequence(frameCount int) []FrameInfo {
+	var frames []FrameInfo
+	hold := func(transition int, t float64) {
+		for i := 1; i < w.Sequence.Hold; i++ {
+			frames = append(frames, FrameInfo{Transition: transition, T: t})
+		}
+	}
+
+	count := w.transitionCount()
+	for transition := 0; transition < count; transition++ {
+		n := w.transitionFrames(transition, frameCount)
+		last := n
+		if transition < count-1 || w.Sequence.Loop == LoopWrap {
+			// The final frame is the next transition's first
+			last = n - 1
+		}
+		for i := 0; i < last; i++ {
+			t := frameTime(i, n)
+			frames = append(frames, FrameInfo{Transition: transition, T: t})
+			if i == 0 {
+				hold(transition, t)
+			}
+		}
+	}
+	if w.Sequence.Loop != LoopWrap && len(frames) > 0 {
+		hold(count-1, frames[len(frames)-1].T)
+	}
+
+	if w.Sequence.Loop == LoopPingPong {
+		// Play back without repeating the held last image, and stop before
+		// the held first image the loop restarts on
+		held := max(1, w.Sequence.Hold)
+		reverse := slices.Clone(frames)
+		slices.Reverse(reverse)
+		if len(reverse) > 2*held {
+			frames = append(frames, reverse[held:len(reverse)-held]...)
+		}
+	}
+
+	for i := range frames {
+		frames[i].Index = i
+	}
+	return frames
+}
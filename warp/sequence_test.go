@@ -0,0 +1,48 @@
+package warp
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+func TestFrameSequence(t *testing.T) {
+	type frame struct {
+		transition int
+		t          float64
+	}
+	tests := []struct {
+		name        string
+		sequence    Sequence
+		transitions []Transition
+		want        []frame
+	}{
+		{"once", Sequence{}, nil, []frame{{0, 0}, {0, 0.5}, {1, 0}, {1, 0.5}, {1, 1}}},
+		{"hold", Sequence{Hold: 2}, nil, []frame{{0, 0}, {0, 0}, {0, 0.5}, {1, 0}, {1, 0}, {1, 0.5}, {1, 1}, {1, 1}}},
+		{"wrap", Sequence{Hold: 2, Loop: LoopWrap}, nil, []frame{{0, 0}, {0, 0}, {0, 0.5}, {1, 0}, {1, 0}, {1, 0.5}, {2, 0}, {2, 0}, {2, 0.5}}},
+		{"ping-pong", Sequence{Hold: 2, Loop: LoopPingPong}, nil, []frame{
+			{0, 0}, {0, 0}, {0, 0.5}, {1, 0}, {1, 0}, {1, 0.5}, {1, 1}, {1, 1},
+			{1, 0.5}, {1, 0}, {1, 0}, {0, 0.5},
+		}},
+		// A single frame transition still shows (and holds) the image it
+		// starts from
+		{"single frame", Sequence{Hold: 2}, []Transition{{Frames: 1}}, []frame{
+			{0, 0}, {0, 0}, {1, 0}, {1, 0}, {1, 0.5}, {1, 1}, {1, 1},
+		}},
+		{"single frame last", Sequence{}, []Transition{{}, {Frames: 1}}, []frame{{0, 0}, {0, 0.5}, {1, 0}, {1, 1}}},
+	}
+	for _, test := range tests {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		job := &WarpJob{Images: []*image.NRGBA{img, img, img}, Sequence: test.sequence, Transitions: test.transitions}
+		var got []frame
+		for i, info := range job.frameSequence(3) {
+			if info.Index != i {
+				t.Errorf("%s: frame %d has index %d", test.name, i, info.Index)
+			}
+			got = append(got, frame{info.Transition, info.T})
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package warp
+
+import (
+	"image"
+	"math"
+)
+
+// TemplateOptions sets the size of the patch compared by MatchTemplate, and
+// how far it searches. The zero value gives the defaults.
+type TemplateOptions struct {
+	Radius int // Half the width of the square patch compared, in pixels. If 0, uses 12
+	Search int // Furthest distance from the predicted location searched, in pixels. If 0, uses 48
+}
+
+func (o TemplateOptions) radius() int {
+	if o.Radius <= 0 {
+		return 12
+	}
+	return o.Radius
+}
+
+func (o TemplateOptions) search() int {
+	if o.Search <= 0 {
+		return 48
+	}
+	return o.Search
+}
+
+// TemplateMatch is where MatchTemplate found a patch
+type TemplateMatch struct {
+	Point image.Point
+	// Confidence is the normalised cross-correlation of the patch with its
+	// match (-1.0 - 1.0). Values near 1 are a close match; a featureless patch,
+	// which matches anywhere, has 0.
+	Confidence float64
+}
+
+// MatchTemplate finds the patch of src around at in dst, searching around
+// predicted, by normalised cross-correlation of their luminance. That is
+// insensitive to differences in brightness and contrast between the images.
+func MatchTemplate(src *image.NRGBA, at image.Point, dst *image.NRGBA, predicted image.Point, opts TemplateOptions) TemplateMatch {
+	radius, search := opts.radius(), opts.search()
+	size := 2*radius + 1
+
+	// The template, less its mean
+	template := lumaWindow(src, at.X-radius, at.Y-radius, size, size)
+	mean := 0.0
+	for _, v := range template {
+		mean += v
+	}
+	mean /= float64(len(template))
+	variance := 0.0
+	for i := range template {
+		template[i] -= mean
+		variance += template[i] * template[i]
+	}
+	if variance < 1e-6 {
+		return TemplateMatch{Point: predicted}
+	}
+
+	// Summed-area tables of the window and its square give each candidate
+	// patch's mean and variance in constant time. The cross-correlation with
+	// the template is still summed over the whole patch.
+	span := 2*search + size
+	window := lumaWindow(dst, predicted.X-search-radius, predicted.Y-search-radius, span, span)
+	sums, sumsSq := make([]float64, (span+1)*(span+1)), make([]float64, (span+1)*(span+1))
+	for y := 0; y < span; y++ {
+		for x := 0; x < span; x++ {
+			v := window[y*span+x]
+			i := (y+1)*(span+1) + x + 1
+			sums[i] = v + sums[i-1] + sums[i-span-1] - sums[i-span-2]
+			sumsSq[i] = v*v + sumsSq[i-1] + sumsSq[i-span-1] - sumsSq[i-span-2]
+		}
+	}
+	patchSum := func(table []float64, x, y int) float64 {
+		top, bottom := y*(span+1), (y+size)*(span+1)
+		return table[bottom+x+size] - table[bottom+x] - table[top+x+size] + table[top+x]
+	}
+
+	best := TemplateMatch{Point: predicted, Confidence: math.Inf(-1)}
+	bestDist := math.MaxInt
+	n := float64(len(template))
+	for oy := 0; oy <= 2*search; oy++ {
+		for ox := 0; ox <= 2*search; ox++ {
+			sum := patchSum(sums, ox, oy)
+			candidateVariance := patchSum(sumsSq, ox, oy) - sum*sum/n
+			if candidateVariance < 1e-6 {
+				continue
+			}
+			// The template sums to zero, so this is already the covariance
+			var cross float64
+			for y := 0; y < size; y++ {
+				row := window[(oy+y)*span+ox:]
+				trow := template[y*size:]
+				for x := 0; x < size; x++ {
+					cross += row[x] * trow[x]
+				}
+			}
+			ncc := cross / math.Sqrt(variance*candidateVariance)
+			// On a tie, prefer the candidate nearest the prediction. Repeated
+			// patterns tie exactly, so allow for rounding in the sums.
+			const tie = 1e-9
+			dx, dy := ox-search, oy-search
+			dist := dx*dx + dy*dy
+			if ncc > best.Confidence+tie || (ncc > best.Confidence-tie && dist < bestDist) {
+				best = TemplateMatch{Point: predicted.Add(image.Pt(dx, dy)), Confidence: ncc}
+				bestDist = dist
+			}
+		}
+	}
+	if math.IsInf(best.Confidence, -1) {
+		return TemplateMatch{Point: predicted}
+	}
+	best.Point = clampPoint(best.Point, dst.Bounds())
+	return best
+}
+
+// lumaWindow returns the luminance (0.0 - 1.0) of the w x h pixels of img
+// from (x0, y0), clamping coordinates outside it to the nearest edge
+func lumaWindow(img *image.NRGBA, x0, y0, w, h int) []float64 {
+	b := img.Bounds()
+	luma := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		sy := max(b.Min.Y, min(y0+y, b.Max.Y-1))
+		for x := 0; x < w; x++ {
+			sx := max(b.Min.X, min(x0+x, b.Max.X-1))
+			p := img.Pix[img.PixOffset(sx, sy):]
+			luma[y*w+x] = (0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])) * float64(p[3]) / (255 * 255)
+		}
+	}
+	return luma
+}
+
+// clampPoint returns p moved to the nearest pixel inside r
+func clampPoint(p image.Point, r image.Rectangle) image.Point {
+	return image.Pt(max(r.Min.X, min(p.X, r.Max.X-1)), max(r.Min.Y, min(p.Y, r.Max.Y-1)))
+}
@@ -0,0 +1,66 @@
+package warp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMatchTemplateShifted(t *testing.T) {
+	a := createTexturedImage(200, 150, 0, 0)
+	b := createTexturedImage(200, 150, 9, -6)
+	// Match at corners, as a flat patch could match anywhere
+	for _, f := range DetectFeatures(a, 5) {
+		at := image.Pt(int(f.X), int(f.Y))
+		match := MatchTemplate(a, at, b, at, TemplateOptions{})
+		if want := at.Add(image.Pt(9, -6)); match.Point != want {
+			t.Errorf("%v: matched at %v, want %v", at, match.Point, want)
+		}
+		if match.Confidence < 0.99 {
+			t.Errorf("%v: confidence %.3f, want ~1", at, match.Confidence)
+		}
+	}
+}
+
+func TestMatchTemplateFeatureless(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for i := range a.Pix {
+		a.Pix[i] = 200
+	}
+	b := createTexturedImage(100, 100, 0, 0)
+	at := image.Pt(50, 50)
+	if match := MatchTemplate(a, at, b, at, TemplateOptions{}); match.Point != at || match.Confidence != 0 {
+		t.Errorf("featureless patch matched at %v with confidence %.3f, want %v with 0", match.Point, match.Confidence, at)
+	}
+
+	// Brightness and contrast changes don't affect the match
+	c := image.NewNRGBA(b.Rect)
+	for i := 0; i < len(b.Pix); i += 4 {
+		for j := 0; j < 3; j++ {
+			c.Pix[i+j] = uint8(40 + int(b.Pix[i+j])/2)
+		}
+		c.Pix[i+3] = 255
+	}
+	if match := MatchTemplate(b, at, c, image.Pt(45, 58), TemplateOptions{}); match.Point != at || match.Confidence < 0.99 {
+		t.Errorf("dimmed image matched at %v with confidence %.3f, want %v with ~1", match.Point, match.Confidence, at)
+	}
+}
+
+func TestMatchTemplateRepeatedPattern(t *testing.T) {
+	// Every period of the stripes matches equally well, so the one nearest
+	// the prediction wins
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 120; x++ {
+			v := uint8(0)
+			if (x/3+y/5)%2 == 0 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	at := image.Pt(60, 60)
+	if match := MatchTemplate(img, at, img, image.Pt(61, 59), TemplateOptions{}); match.Point != at {
+		t.Errorf("matched at %v, want the nearest repeat %v", match.Point, at)
+	}
+}
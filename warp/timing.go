@@ -0,0 +1,250 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Easing maps linear time through a transition (0.0 - 1.0) to the progress
+// of the morph at that time (also 0.0 - 1.0)
+type Easing func(t float64) float64
+
+// Linear progresses at a constant rate
+func Linear(t float64) float64 { return t }
+
+// EaseIn starts slowly and accelerates
+func EaseIn(t float64) float64 { return t * t * t }
+
+// EaseOut starts quickly and decelerates
+func EaseOut(t float64) float64 { return 1 - EaseIn(1-t) }
+
+// EaseInOut accelerates through the first half and decelerates through the second
+func EaseInOut(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	return 1 - 4*(1-t)*(1-t)*(1-t)
+}
+
+// CubicBezier returns a CSS style easing curve, running from (0,0) to (1,1)
+// with control points (x1,y1) and (x2,y2). x1 & x2 must be within 0-1.
+func CubicBezier(x1, y1, x2, y2 float64) Easing {
+	bezier := func(s, p1, p2 float64) float64 {
+		return 3*(1-s)*(1-s)*s*p1 + 3*(1-s)*s*s*p2 + s*s*s
+	}
+	return func(t float64) float64 {
+		if t <= 0 || t >= 1 {
+			return t
+		}
+		// x(s) is monotonic for x1, x2 in 0-1, so bisect to find s where x(s) = t
+		lo, hi := 0.0, 1.0
+		for i := 0; i < 40; i++ {
+			mid := (lo + hi) / 2
+			if bezier(mid, x1, x2) < t {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return bezier((lo+hi)/2, y1, y2)
+	}
+}
+
+// Steps jumps between n evenly spaced levels, rather than progressing smoothly
+func Steps(n int) Easing {
+	return func(t float64) float64 {
+		if t >= 1 {
+			return 1
+		}
+		return math.Floor(t*float64(n)) / float64(n)
+	}
+}
+
+// Curve is a custom easing through the given [t, progress] points, smoothly
+// interpolated between them without overshooting. Points must be sorted by t.
+func Curve(points [][2]float64) Easing {
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		xs[i], ys[i] = p[0], p[1]
+	}
+	spline := newMonotoneSpline(xs, ys)
+	return func(t float64) float64 {
+		return math.Max(0, math.Min(1, spline.at(t)))
+	}
+}
+
+// EasingSaveFormat is the json form of an Easing
+type EasingSaveFormat struct {
+	// Type is one of "linear", "ease-in", "ease-out", "ease-in-out",
+	// "cubic-bezier", "step" or "curve"
+	Type string `json:"type"`
+	// Points are the two control points for "cubic-bezier", or the [t,
+	// progress] points for "curve"
+	Points [][2]float64 `json:"points,omitempty"`
+	Steps  int          `json:"steps,omitempty"` // Number of steps for "step"
+}
+
+// Easing converts the saved description into an Easing
+func (e *EasingSaveFormat) Easing() (Easing, error) {
+	switch e.Type {
+	case "", "linear":
+		return Linear, nil
+	case "ease-in":
+		return EaseIn, nil
+	case "ease-out":
+		return EaseOut, nil
+	case "ease-in-out":
+		return EaseInOut, nil
+	case "cubic-bezier":
+		if len(e.Points) != 2 {
+			return nil, fmt.Errorf("cubic-bezier easing needs 2 control points, have %d", len(e.Points))
+		}
+		return CubicBezier(e.Points[0][0], e.Points[0][1], e.Points[1][0], e.Points[1][1]), nil
+	case "step":
+		if e.Steps < 1 {
+			return nil, fmt.Errorf("step easing needs at least 1 step, have %d", e.Steps)
+		}
+		return Steps(e.Steps), nil
+	case "curve":
+		if len(e.Points) < 2 {
+			return nil, fmt.Errorf("curve easing needs at least 2 points, have %d", len(e.Points))
+		}
+		return Curve(e.Points), nil
+	default:
+		return nil, fmt.Errorf("unknown easing: %q", e.Type)
+	}
+}
+
+// Schedule runs one part of the morph (shape or colour) over a portion of
+// the transition, so for example the shape can finish at 70% while the colour
+// keeps dissolving until the end
+type Schedule struct {
+	Start, End float64 // Portion of the transition (0.0 - 1.0) to run over
+	Easing     Easing  // Applied between Start and End. If nil, uses the transition's Easing
+}
+
+// Transition holds the timing of the morph from one image to the next
+type Transition struct {
+	Frames   int     // Number of frames, at least 2. If 0, uses Duration
+	Duration float64 // Length in seconds, at the job's FPS. If 0, uses the job's default frame count
+	Easing   Easing  // If nil, uses Linear
+
+	// Shape & Color schedule the geometry interpolation and the
+	// cross-dissolve separately. If nil, they run over the whole transition.
+	Shape, Color *Schedule
+
+	// Mask is an optional greyscale image, in the geometry of the first
+	// image, that varies the dissolve rate per pixel. White regions dissolve
+	// during the first half of the transition, black regions during the
+	// second half, and greys in between.
+	Mask *image.NRGBA
+}
+
+// ScheduleSaveFormat is the json form of a Schedule
+type ScheduleSaveFormat struct {
+	Start  float64           `json:"start,omitempty"`
+	End    float64           `json:"end,omitempty"` // If 0, runs to the end of the transition
+	Easing *EasingSaveFormat `json:"easing,omitempty"`
+}
+
+// Schedule converts the saved description into a Schedule
+func (s *ScheduleSaveFormat) Schedule() (*Schedule, error) {
+	schedule := &Schedule{Start: s.Start, End: s.End}
+	if schedule.End == 0 {
+		schedule.End = 1
+	}
+	if schedule.Start < 0 || schedule.End > 1 || schedule.End <= schedule.Start {
+		return nil, fmt.Errorf("invalid schedule: start %g, end %g", schedule.Start, schedule.End)
+	}
+	if s.Easing != nil {
+		var err error
+		if schedule.Easing, err = s.Easing.Easing(); err != nil {
+			return nil, err
+		}
+	}
+	return schedule, nil
+}
+
+// TransitionSaveFormat is the json form of a Transition
+type TransitionSaveFormat struct {
+	Frames   int                 `json:"frames,omitempty"`
+	Duration float64             `json:"duration,omitempty"`
+	Easing   *EasingSaveFormat   `json:"easing,omitempty"`
+	Shape    *ScheduleSaveFormat `json:"shape,omitempty"`
+	Color    *ScheduleSaveFormat `json:"color,omitempty"`
+	Mask     string              `json:"mask,omitempty"` // Path to a greyscale dissolve mask
+}
+
+// Transition converts the saved description into a Transition
+func (t *TransitionSaveFormat) Transition() (Transition, error) {
+	tr := Transition{Frames: t.Frames, Duration: t.Duration}
+	var err error
+	if t.Easing != nil {
+		if tr.Easing, err = t.Easing.Easing(); err != nil {
+			return tr, err
+		}
+	}
+	if t.Shape != nil {
+		if tr.Shape, err = t.Shape.Schedule(); err != nil {
+			return tr, fmt.Errorf("shape: %w", err)
+		}
+	}
+	if t.Color != nil {
+		if tr.Color, err = t.Color.Schedule(); err != nil {
+			return tr, fmt.Errorf("color: %w", err)
+		}
+	}
+	return tr, nil
+}
+
+// transition returns the timing for the morph from Images[idx] to
+// Images[idx+1]
+func (w *WarpJob) transition(idx int) Transition {
+	if idx < len(w.Transitions) {
+		return w.Transitions[idx]
+	}
+	return Transition{}
+}
+
+// transitionFrames returns the number of frames to render for the morph from
+// Images[idx] to Images[idx+1]. That is at least 2, so both images are shown.
+func (w *WarpJob) transitionFrames(idx int, defaultFrames int) int {
+	tr := w.transition(idx)
+	frames := defaultFrames
+	switch {
+	case tr.Frames > 0:
+		frames = tr.Frames
+	case tr.Duration > 0 && w.FPS > 0:
+		// Frames are at both ends of the transition, so Duration spans one
+		// fewer frame intervals than there are frames
+		frames = int(math.Round(tr.Duration*w.FPS)) + 1
+	}
+	// A transition shares its last frame with the next one's first, so with
+	// a single frame the image it starts from would never be shown
+	return max(2, frames)
+}
+
+// progress returns the eased shape and colour progress at linear time t
+// (0.0 - 1.0) through the morph from Images[idx] to Images[idx+1]
+func (w *WarpJob) progress(idx int, t float64) (shape, color float64) {
+	tr := w.transition(idx)
+	return tr.Shape.apply(t, tr.Easing), tr.Color.apply(t, tr.Easing)
+}
+
+// apply maps linear transition time t through the schedule. A nil schedule
+// runs over the whole transition.
+func (s *Schedule) apply(t float64, transitionEasing Easing) float64 {
+	easing := transitionEasing
+	if s != nil {
+		t = math.Max(0, math.Min(1, (t-s.Start)/(s.End-s.Start)))
+		if s.Easing != nil {
+			easing = s.Easing
+		}
+	}
+	if easing == nil {
+		return t
+	}
+	return easing(t)
+}
@@ -0,0 +1,81 @@
+package warp
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestEasingEndpoints(t *testing.T) {
+	easings := map[string]Easing{
+		"linear":       Linear,
+		"ease-in":      EaseIn,
+		"ease-out":     EaseOut,
+		"ease-in-out":  EaseInOut,
+		"cubic-bezier": CubicBezier(0.42, 0, 0.58, 1),
+		"step":         Steps(4),
+		"curve":        Curve([][2]float64{{0, 0}, {0.3, 0.7}, {1, 1}}),
+	}
+	for name, easing := range easings {
+		if got := easing(0); math.Abs(got) > 1e-9 {
+			t.Errorf("%s(0) = %g, want 0", name, got)
+		}
+		if got := easing(1); math.Abs(got-1) > 1e-9 {
+			t.Errorf("%s(1) = %g, want 1", name, got)
+		}
+	}
+}
+
+func TestCubicBezierMatchesEaseInOut(t *testing.T) {
+	// A symmetric bezier passes through the middle
+	if got := CubicBezier(0.42, 0, 0.58, 1)(0.5); math.Abs(got-0.5) > 1e-6 {
+		t.Errorf("bezier(0.5) = %g, want 0.5", got)
+	}
+	// A linear bezier is the identity
+	linear := CubicBezier(1.0/3, 1.0/3, 2.0/3, 2.0/3)
+	for _, x := range []float64{0.1, 0.25, 0.8} {
+		if got := linear(x); math.Abs(got-x) > 1e-6 {
+			t.Errorf("linear bezier(%g) = %g", x, got)
+		}
+	}
+}
+
+func TestTransitionFrames(t *testing.T) {
+	job := WarpJob{
+		FPS:         25,
+		Transitions: []Transition{{Frames: 10}, {Duration: 2}},
+	}
+	// 2s at 25fps is 50 frame intervals, so 51 frames including both ends
+	for idx, want := range []int{10, 51, 21} {
+		if got := job.transitionFrames(idx, 21); got != want {
+			t.Errorf("transition %d has %d frames, want %d", idx, got, want)
+		}
+	}
+
+	// Consecutive transitions share their boundary frame, so two 1s
+	// transitions at 10fps play for 2s: 20 intervals, 21 frames
+	job = WarpJob{
+		Images:      make([]*image.NRGBA, 3),
+		FPS:         10,
+		Transitions: []Transition{{Duration: 1}, {Duration: 1}},
+	}
+	if got := job.totalFrames(21); got != 21 {
+		t.Errorf("two 1s transitions have %d frames, want 21", got)
+	}
+}
+
+func TestScheduleProgress(t *testing.T) {
+	job := WarpJob{
+		Transitions: []Transition{{
+			Shape: &Schedule{Start: 0, End: 0.7},
+			Color: &Schedule{Start: 0.2, End: 1},
+		}},
+	}
+	// Shape completes at 0.7, while color has run 5/8 of its 0.2 - 1 range
+	if shape, color := job.progress(0, 0.7); math.Abs(shape-1) > 1e-9 || math.Abs(color-0.625) > 1e-9 {
+		t.Errorf("progress at 0.7 = %g, %g, want 1, 0.625", shape, color)
+	}
+	if shape, color := job.progress(0, 0.1); math.Abs(shape-1.0/7) > 1e-9 || color != 0 {
+		t.Errorf("progress at 0.1 = %g, %g, want 1/7, 0", shape, color)
+	}
+}
@@ -0,0 +1,145 @@
+package warp
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/delaunay"
+)
+
+// thinPlateSpline is a smooth 2D mapping that passes through (or, when
+// regularised, near) a set of control points
+type thinPlateSpline struct {
+	ctrl   []delaunay.Point
+	wx, wy []float64  // Kernel weights per control point
+	ax, ay [3]float64 // Affine part: a0 + a1*x + a2*y
+}
+
+// tpsKernel is the thin plate radial basis function U(r) = r^2 log r^2,
+// taking r^2 directly
+func tpsKernel(rSq float64) float64 {
+	if rSq == 0 {
+		return 0
+	}
+	return rSq * math.Log(rSq)
+}
+
+// newThinPlateSpline fits a spline mapping each ctrl point to the matching
+// target point. regularization trades exact interpolation for smoothness; it
+// is relative to the mean squared distance between control points, so the
+// same value behaves similarly regardless of image size.
+func newThinPlateSpline(ctrl, target []delaunay.Point, regularization float64) (*thinPlateSpline, error) {
+	if len(ctrl) != len(target) {
+		return nil, fmt.Errorf("control and target point lists must have the same length")
+	}
+	n := len(ctrl)
+	size := n + 3
+
+	var meanDistSq float64
+	for i := range ctrl {
+		for j := range ctrl {
+			dx, dy := ctrl[i].X-ctrl[j].X, ctrl[i].Y-ctrl[j].Y
+			meanDistSq += dx*dx + dy*dy
+		}
+	}
+	if n > 1 {
+		meanDistSq /= float64(n * (n - 1))
+	}
+	lambda := regularization * meanDistSq
+
+	// Build the system [K+lambda*I P; P^T 0] [w; a] = [v; 0], with one
+	// right hand side column each for x & y
+	m := make([][]float64, size)
+	for i := range m {
+		m[i] = make([]float64, size+2)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			dx, dy := ctrl[i].X-ctrl[j].X, ctrl[i].Y-ctrl[j].Y
+			m[i][j] = tpsKernel(dx*dx + dy*dy)
+		}
+		m[i][i] += lambda
+		m[i][n], m[i][n+1], m[i][n+2] = 1, ctrl[i].X, ctrl[i].Y
+		m[n][i], m[n+1][i], m[n+2][i] = 1, ctrl[i].X, ctrl[i].Y
+		m[i][size], m[i][size+1] = target[i].X, target[i].Y
+	}
+	if err := solveLinear(m); err != nil {
+		return nil, fmt.Errorf("unable to fit thin plate spline: %w", err)
+	}
+
+	tps := &thinPlateSpline{ctrl: ctrl, wx: make([]float64, n), wy: make([]float64, n)}
+	for i := 0; i < n; i++ {
+		tps.wx[i], tps.wy[i] = m[i][size], m[i][size+1]
+	}
+	for i := 0; i < 3; i++ {
+		tps.ax[i], tps.ay[i] = m[n+i][size], m[n+i][size+1]
+	}
+	return tps, nil
+}
+
+// Map evaluates the spline at (x,y)
+func (t *thinPlateSpline) Map(x, y float64) (float64, float64) {
+	sx := t.ax[0] + t.ax[1]*x + t.ax[2]*y
+	sy := t.ay[0] + t.ay[1]*x + t.ay[2]*y
+	for i, c := range t.ctrl {
+		dx, dy := x-c.X, y-c.Y
+		u := tpsKernel(dx*dx + dy*dy)
+		sx += t.wx[i] * u
+		sy += t.wy[i] * u
+	}
+	return sx, sy
+}
+
+// solveLinear solves the augmented system m in place by Gaussian elimination
+// with partial pivoting. m has one row per unknown; the columns past the
+// square part are right hand sides, and are replaced by the solutions.
+func solveLinear(m [][]float64) error {
+	n := len(m)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return fmt.Errorf("singular matrix (duplicate or collinear points?)")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := 0; row < n; row++ {
+			if row == col {
+				continue
+			}
+			f := m[row][col] / m[col][col]
+			if f == 0 {
+				continue
+			}
+			for k := col; k < len(m[row]); k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+	for row := 0; row < n; row++ {
+		d := m[row][row]
+		for k := n; k < len(m[row]); k++ {
+			m[row][k] /= d
+		}
+	}
+	return nil
+}
+
+// WarpImageTPS warps srcImg with a thin plate spline. dstPoints are the
+// control points in the geometry of the output image, and srcPoints the
+// matching points in srcImg. Every output pixel is inverse mapped through the
+// spline, so there are no creases along triangle edges as with WarpImage.
+func WarpImageTPS(srcImg *image.NRGBA, dstPoints, srcPoints []delaunay.Point, regularization float64, opts WarpOptions) (*image.NRGBA, error) {
+	tps, err := newThinPlateSpline(dstPoints, srcPoints, regularization)
+	if err != nil {
+		return nil, err
+	}
+	dstImg := image.NewNRGBA(srcImg.Bounds())
+	warpInverse(srcImg, dstImg, tps.Map, opts)
+	return dstImg, nil
+}
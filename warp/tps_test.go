@@ -0,0 +1,33 @@
+package warp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+func TestThinPlateSplineInterpolates(t *testing.T) {
+	ctrl := []delaunay.Point{{X: 0, Y: 0}, {X: 100, Y: 0}, {X: 0, Y: 100}, {X: 100, Y: 100}, {X: 40, Y: 60}}
+	target := []delaunay.Point{{X: 0, Y: 0}, {X: 100, Y: 0}, {X: 0, Y: 100}, {X: 100, Y: 100}, {X: 55, Y: 45}}
+
+	tps, err := newThinPlateSpline(ctrl, target, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range ctrl {
+		x, y := tps.Map(c.X, c.Y)
+		if math.Abs(x-target[i].X) > 1e-6 || math.Abs(y-target[i].Y) > 1e-6 {
+			t.Errorf("point %d maps to (%g,%g), want %v", i, x, y, target[i])
+		}
+	}
+
+	// Regularised splines are smoother, so no longer hit the moved point exactly
+	smooth, err := newThinPlateSpline(ctrl, target, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := smooth.Map(40, 60); math.Abs(x-55) < 1 {
+		t.Errorf("regularised spline still interpolates exactly: x = %g", x)
+	}
+}
@@ -0,0 +1,133 @@
+package warp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fogleman/delaunay"
+)
+
+// Trajectory selects the path each control point follows through the
+// keyframes of a job with three or more images
+type Trajectory int
+
+const (
+	// TrajectoryLinear moves each point in a straight line from one image to
+	// the next, with a change of velocity at each image
+	TrajectoryLinear Trajectory = iota
+	// TrajectoryCatmullRom follows a uniform Catmull-Rom spline through every
+	// image, so motion flows smoothly across the whole sequence
+	TrajectoryCatmullRom
+	// TrajectoryCentripetal is a centripetal Catmull-Rom spline, which avoids
+	// the loops and overshoot uniform splines give when a point moves much
+	// further in one transition than its neighbours
+	TrajectoryCentripetal
+)
+
+// TrajectoryByName looks up a trajectory from its command line/json name
+func TrajectoryByName(name string) (Trajectory, error) {
+	switch name {
+	case "", "linear":
+		return TrajectoryLinear, nil
+	case "catmull-rom":
+		return TrajectoryCatmullRom, nil
+	case "centripetal":
+		return TrajectoryCentripetal, nil
+	default:
+		return 0, fmt.Errorf("unknown trajectory: %q", name)
+	}
+}
+
+// trajectoryPoints returns the points at time t through the morph from
+// keyframes[transition] to the next keyframe, following w.Trajectory through
+// all of keyframes
+func (w *WarpJob) trajectoryPoints(keyframes [][]delaunay.Point, transition int, t float64) []delaunay.Point {
+	n := len(keyframes)
+	next := (transition + 1) % n
+	if w.Trajectory == TrajectoryLinear || n < 3 {
+		return lerpPoints(keyframes[transition], keyframes[next], t)
+	}
+	alpha := 0.0
+	if w.Trajectory == TrajectoryCentripetal {
+		alpha = 0.5
+	}
+	// A looping sequence wraps around, so the spline is smooth through the
+	// first image too
+	wrap := w.Sequence.Loop == LoopWrap
+	p1, p2 := keyframes[transition], keyframes[next]
+	points := make([]delaunay.Point, len(p1))
+	for i := range points {
+		// Past the first and last images, extrapolate the end segment so the
+		// spline leaves and arrives along it
+		var p0, p3 delaunay.Point
+		if transition > 0 || wrap {
+			p0 = keyframes[(transition+n-1)%n][i]
+		} else {
+			p0 = sub(p1[i], sub(p2[i], p1[i]))
+		}
+		if transition+2 < n || wrap {
+			p3 = keyframes[(transition+2)%n][i]
+		} else {
+			p3 = add(p2[i], sub(p2[i], p1[i]))
+		}
+		points[i] = catmullRom(p0, p1[i], p2[i], p3, t, alpha)
+	}
+	return points
+}
+
+// trajectoryLines is trajectoryPoints for the endpoints of feature lines
+func (w *WarpJob) trajectoryLines(keyframes [][]Line, transition int, t float64) []Line {
+	if w.Trajectory == TrajectoryLinear || len(keyframes) < 3 {
+		return lerpLines(keyframes[transition], keyframes[(transition+1)%len(keyframes)], t)
+	}
+	endpoints := make([][]delaunay.Point, len(keyframes))
+	for k, lines := range keyframes {
+		for _, l := range lines {
+			endpoints[k] = append(endpoints[k], l.P, l.Q)
+		}
+	}
+	points := w.trajectoryPoints(endpoints, transition, t)
+	lines := make([]Line, len(points)/2)
+	for i := range lines {
+		lines[i] = Line{P: points[2*i], Q: points[2*i+1]}
+	}
+	return lines
+}
+
+// catmullRom evaluates the Catmull-Rom segment from p1 (t=0) to p2 (t=1),
+// using the Barry-Goldman pyramidal formulation. The knots are spaced by
+// distance^alpha: 0 gives the uniform spline, 0.5 the centripetal one.
+func catmullRom(p0, p1, p2, p3 delaunay.Point, t, alpha float64) delaunay.Point {
+	knot := func(a, b delaunay.Point) float64 {
+		return math.Pow(math.Hypot(b.X-a.X, b.Y-a.Y), alpha)
+	}
+	d12 := knot(p1, p2)
+	if d12 < 1e-9 {
+		return p1 // The point doesn't move in this transition
+	}
+	// A repeated neighbour has no direction to offer, so space it as if it
+	// were as far away as the segment itself
+	d01, d23 := knot(p0, p1), knot(p2, p3)
+	if d01 < 1e-9 {
+		d01 = d12
+	}
+	if d23 < 1e-9 {
+		d23 = d12
+	}
+
+	t0, t1 := 0.0, d01
+	t2 := t1 + d12
+	t3 := t2 + d23
+	u := t1 + t*d12
+
+	lerp := func(a, b delaunay.Point, ta, tb float64) delaunay.Point {
+		f := (u - ta) / (tb - ta)
+		return delaunay.Point{X: a.X + (b.X-a.X)*f, Y: a.Y + (b.Y-a.Y)*f}
+	}
+	a1 := lerp(p0, p1, t0, t1)
+	a2 := lerp(p1, p2, t1, t2)
+	a3 := lerp(p2, p3, t2, t3)
+	b1 := lerp(a1, a2, t0, t2)
+	b2 := lerp(a2, a3, t1, t3)
+	return lerp(b1, b2, t1, t2)
+}
@@ -0,0 +1,45 @@
+package warp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+func TestTrajectoryPassesThroughKeyframes(t *testing.T) {
+	keyframes := [][]delaunay.Point{{{X: 0, Y: 0}}, {{X: 10, Y: 0}}, {{X: 10, Y: 30}}, {{X: 40, Y: 30}}}
+	for _, trajectory := range []Trajectory{TrajectoryLinear, TrajectoryCatmullRom, TrajectoryCentripetal} {
+		job := &WarpJob{Trajectory: trajectory}
+		for from := 0; from < len(keyframes)-1; from++ {
+			for _, end := range []int{0, 1} {
+				got := job.trajectoryPoints(keyframes, from, float64(end))[0]
+				want := keyframes[from+end][0]
+				if math.Abs(got.X-want.X) > 1e-9 || math.Abs(got.Y-want.Y) > 1e-9 {
+					t.Errorf("trajectory %d, transition %d, t=%d: got %v, want %v", trajectory, from, end, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCatmullRomSmoothAtKeyframes(t *testing.T) {
+	// Evenly spaced keyframes, so the uniform spline's velocity is
+	// continuous across each image
+	keyframes := [][]delaunay.Point{{{X: 0, Y: 0}}, {{X: 10, Y: 0}}, {{X: 20, Y: 10}}}
+	job := &WarpJob{Trajectory: TrajectoryCatmullRom}
+	const h = 1e-6
+	before := sub(job.trajectoryPoints(keyframes, 0, 1)[0], job.trajectoryPoints(keyframes, 0, 1-h)[0])
+	after := sub(job.trajectoryPoints(keyframes, 1, h)[0], job.trajectoryPoints(keyframes, 1, 0)[0])
+	if math.Abs(before.X-after.X) > 1e-6 || math.Abs(before.Y-after.Y) > 1e-6 {
+		t.Errorf("velocity changes at keyframe: %v before, %v after", before, after)
+	}
+
+	// Linear interpolation has a kink there
+	job.Trajectory = TrajectoryLinear
+	before = sub(job.trajectoryPoints(keyframes, 0, 1)[0], job.trajectoryPoints(keyframes, 0, 1-h)[0])
+	after = sub(job.trajectoryPoints(keyframes, 1, h)[0], job.trajectoryPoints(keyframes, 1, 0)[0])
+	if math.Abs(before.Y-after.Y) < 1e-7 {
+		t.Errorf("expected linear velocity to change at the keyframe")
+	}
+}
@@ -1,6 +1,7 @@
 package warp
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
@@ -32,58 +33,40 @@ func inv2x2(M [2][2]float64) (Minv [2][2]float64, ok bool) {
 }
 
 // Bilinear sampling from *image.NRGBA at floating point (x,y).
-func sampleBilinear(rgba *image.NRGBA, x, y float64) color.NRGBA {
-	b := rgba.Bounds()
-	if x < float64(b.Min.X) {
-		x = float64(b.Min.X)
-	}
-	if y < float64(b.Min.Y) {
-		y = float64(b.Min.Y)
-	}
-	if x > float64(b.Max.X-1) {
-		x = float64(b.Max.X - 1)
-	}
-	if y > float64(b.Max.Y-1) {
-		y = float64(b.Max.Y - 1)
-	}
-
+func sampleBilinear(rgba *image.NRGBA, x, y float64, border Border) color.NRGBA {
 	x0 := int(math.Floor(x))
 	y0 := int(math.Floor(y))
 	x1 := x0 + 1
 	y1 := y0 + 1
-	if x1 >= b.Max.X {
-		x1 = b.Max.X - 1
-	}
-	if y1 >= b.Max.Y {
-		y1 = b.Max.Y - 1
-	}
 
 	fx := x - float64(x0)
 	fy := y - float64(y0)
 
-	c00 := rgba.NRGBAAt(x0, y0)
-	c10 := rgba.NRGBAAt(x1, y0)
-	c01 := rgba.NRGBAAt(x0, y1)
-	c11 := rgba.NRGBAAt(x1, y1)
+	c00 := border.pixel(rgba, x0, y0)
+	c10 := border.pixel(rgba, x1, y0)
+	c01 := border.pixel(rgba, x0, y1)
+	c11 := border.pixel(rgba, x1, y1)
 
 	lerp := func(a, b float64, t float64) float64 { return a + (b-a)*t }
 
-	r00 := float64(c00.R)
-	r10 := float64(c10.R)
-	r01 := float64(c01.R)
-	r11 := float64(c11.R)
-	g00 := float64(c00.G)
-	g10 := float64(c10.G)
-	g01 := float64(c01.G)
-	g11 := float64(c11.G)
-	b00 := float64(c00.B)
-	b10 := float64(c10.B)
-	b01 := float64(c01.B)
-	b11 := float64(c11.B)
 	a00 := float64(c00.A)
 	a10 := float64(c10.A)
 	a01 := float64(c01.A)
 	a11 := float64(c11.A)
+	// Interpolate premultiplied colours, so transparent pixels don't bleed
+	// their (meaningless) colour into the edges of opaque regions
+	r00 := float64(c00.R) * a00
+	r10 := float64(c10.R) * a10
+	r01 := float64(c01.R) * a01
+	r11 := float64(c11.R) * a11
+	g00 := float64(c00.G) * a00
+	g10 := float64(c10.G) * a10
+	g01 := float64(c01.G) * a01
+	g11 := float64(c11.G) * a11
+	b00 := float64(c00.B) * a00
+	b10 := float64(c10.B) * a10
+	b01 := float64(c01.B) * a01
+	b11 := float64(c11.B) * a11
 
 	r0 := lerp(r00, r10, fx)
 	r1 := lerp(r01, r11, fx)
@@ -94,17 +77,135 @@ func sampleBilinear(rgba *image.NRGBA, x, y float64) color.NRGBA {
 	a0 := lerp(a00, a10, fx)
 	a1 := lerp(a01, a11, fx)
 
-	R := uint8(math.Round(lerp(r0, r1, fy)))
-	G := uint8(math.Round(lerp(g0, g1, fy)))
-	B := uint8(math.Round(lerp(b0, b1, fy)))
-	A := uint8(math.Round(lerp(a0, a1, fy)))
+	a := lerp(a0, a1, fy)
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	R := clampChannel(lerp(r0, r1, fy) / a)
+	G := clampChannel(lerp(g0, g1, fy) / a)
+	B := clampChannel(lerp(b0, b1, fy) / a)
+	A := uint8(math.Round(a))
 
 	return color.NRGBA{R, G, B, A}
 }
 
+// sampleBilinearFast is equivalent to sampleBilinear with a clamped border,
+// but reads the pixels straight from src.Pix
+func sampleBilinearFast(src *image.NRGBA, x, y float64) (r, g, b, a uint8) {
+	bounds := src.Bounds()
+	x = math.Max(float64(bounds.Min.X), math.Min(x, float64(bounds.Max.X-1)))
+	y = math.Max(float64(bounds.Min.Y), math.Min(y, float64(bounds.Max.Y-1)))
+
+	// Coordinates are clamped to be >= Min, so truncation is floor
+	x0 := int(x-float64(bounds.Min.X)) + bounds.Min.X
+	y0 := int(y-float64(bounds.Min.Y)) + bounds.Min.Y
+	fx := x - float64(x0)
+	fy := y - float64(y0)
+
+	dx, dy := 4, src.Stride
+	if x0+1 >= bounds.Max.X {
+		dx = 0
+	}
+	if y0+1 >= bounds.Max.Y {
+		dy = 0
+	}
+	i := src.PixOffset(x0, y0)
+	p00 := src.Pix[i : i+4 : i+4]
+	p10 := src.Pix[i+dx : i+dx+4 : i+dx+4]
+	p01 := src.Pix[i+dy : i+dy+4 : i+dy+4]
+	p11 := src.Pix[i+dx+dy : i+dx+dy+4 : i+dx+dy+4]
+
+	// Bilinear weights for each of the 4 pixels, premultiplied by alpha
+	w00 := (1 - fx) * (1 - fy) * float64(p00[3])
+	w10 := fx * (1 - fy) * float64(p10[3])
+	w01 := (1 - fx) * fy * float64(p01[3])
+	w11 := fx * fy * float64(p11[3])
+	alpha := w00 + w10 + w01 + w11
+	if alpha == 0 {
+		return 0, 0, 0, 0
+	}
+	ia := 1 / alpha
+	r = clampChannel((w00*float64(p00[0]) + w10*float64(p10[0]) + w01*float64(p01[0]) + w11*float64(p11[0])) * ia)
+	g = clampChannel((w00*float64(p00[1]) + w10*float64(p10[1]) + w01*float64(p01[1]) + w11*float64(p11[1])) * ia)
+	b = clampChannel((w00*float64(p00[2]) + w10*float64(p10[2]) + w01*float64(p01[2]) + w11*float64(p11[2])) * ia)
+	return r, g, b, uint8(alpha + 0.5)
+}
+
+// WarpOptions controls how the source image is resampled while warping.
+// The zero value gives the default behaviour.
+type WarpOptions struct {
+	Sampler Sampler // Resampling filter. If nil, uses bilinear
+
+	// AntiAlias supersamples pixels on triangle edges and blends the
+	// contributions of neighbouring triangles, rather than doing a hard
+	// inside test on pixel centres. This avoids jagged edges and cracks
+	// between triangles in strongly distorted meshes.
+	AntiAlias bool
+
+	// GridStep is the spacing, in pixels, at which smooth inverse mapped
+	// warps (field lines, thin plate splines, MLS) evaluate their mapping, with
+	// bilinear interpolation between. 1 evaluates every pixel. If 0, uses
+	// DefaultGridStep.
+	GridStep int
+
+	// Border controls what is sampled where the warp maps outside the source
+	// image. The zero value clamps to the edge pixels.
+	Border Border
+
+	// Threads splits the output into bands rendered concurrently. 0 or 1
+	// renders on the calling goroutine only.
+	Threads int
+
+	pool workerPool      // Shared thread budget; overrides Threads when set by WarpJob
+	ctx  context.Context // Abandons the rest of the warp when cancelled, when set by WarpJob
+}
+
+func (o WarpOptions) sampler() Sampler {
+	if o.Sampler == nil {
+		return BilinearSampler{}
+	}
+	return o.Sampler
+}
+
+// fastBilinear reports whether sampling can use sampleBilinearFast
+func (o WarpOptions) fastBilinear() bool {
+	_, bilinear := o.sampler().(BilinearSampler)
+	return bilinear && o.Border.Mode == BorderClamp
+}
+
+// context returns the context the warp stops early on
+func (o WarpOptions) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// workers returns the pool of extra threads available to a single warp
+func (o WarpOptions) workers() workerPool {
+	if o.pool != nil {
+		return o.pool
+	}
+	if o.Threads > 1 {
+		return make(workerPool, o.Threads-1)
+	}
+	return nil
+}
+
+func (o WarpOptions) gridStep() int {
+	if o.GridStep <= 0 {
+		return DefaultGridStep
+	}
+	return o.GridStep
+}
+
 // WarpTriangle maps src triangle S -> dst triangle D by filling into dst image.
 // srcImg may be any image.Image; dst must be draw.Image (e.g. *image.RGBA).
 func WarpTriangle(src *image.NRGBA, dst *image.NRGBA, S [3]delaunay.Point, D [3]delaunay.Point) error {
+	return warpTriangle(src, dst, S, D, WarpOptions{})
+}
+
+func warpTriangle(src *image.NRGBA, dst *image.NRGBA, S [3]delaunay.Point, D [3]delaunay.Point, opts WarpOptions) error {
 	// Build edge matrices: P = [S1-S0 | S2-S0], Q = [D1-D0 | D2-D0]
 	P := [2][2]float64{
 		{S[1].X - S[0].X, S[2].X - S[0].X},
@@ -121,55 +222,88 @@ func WarpTriangle(src *image.NRGBA, dst *image.NRGBA, S [3]delaunay.Point, D [3]
 	}
 
 	// Precompute bounding box of the destination triangle to scan.
-	minX := int(math.Floor(math.Min(D[0].X, math.Min(D[1].X, D[2].X))))
-	maxX := int(math.Ceil(math.Max(D[0].X, math.Max(D[1].X, D[2].X))))
 	minY := int(math.Floor(math.Min(D[0].Y, math.Min(D[1].Y, D[2].Y))))
 	maxY := int(math.Ceil(math.Max(D[0].Y, math.Max(D[1].Y, D[2].Y))))
 
 	dstBounds := dst.Bounds()
-	if minX < dstBounds.Min.X {
-		minX = dstBounds.Min.X
-	}
 	if minY < dstBounds.Min.Y {
 		minY = dstBounds.Min.Y
 	}
-	if maxX > dstBounds.Max.X {
-		maxX = dstBounds.Max.X
-	}
 	if maxY > dstBounds.Max.Y {
 		maxY = dstBounds.Max.Y
 	}
 
-	// Scanline over the destination bounding box.
+	// The barycentric-like coords (u,v) solving Q * [u v]^T = (p - D0), and
+	// w = 1 - u - v, are all linear in the pixel position. Express each as
+	// dx*px + dy*py + c, so spans and steps can be computed per scanline.
+	edges := [3][3]float64{
+		{Qinv[0][0], Qinv[0][1], -(Qinv[0][0]*D[0].X + Qinv[0][1]*D[0].Y)},
+		{Qinv[1][0], Qinv[1][1], -(Qinv[1][0]*D[0].X + Qinv[1][1]*D[0].Y)},
+	}
+	edges[2] = [3]float64{-edges[0][0] - edges[1][0], -edges[0][1] - edges[1][1], 1 - edges[0][2] - edges[1][2]}
+
+	// Source position s = S0 + P * [u v] steps by a constant amount per pixel
+	stepSX := P[0][0]*Qinv[0][0] + P[0][1]*Qinv[1][0]
+	stepSY := P[1][0]*Qinv[0][0] + P[1][1]*Qinv[1][0]
+
+	sampler := opts.sampler()
+	bilinear := opts.fastBilinear()
+
 	for y := minY; y < maxY; y++ {
-		for x := minX; x < maxX; x++ {
-			// Center of pixel for nicer results
-			p := delaunay.Point{float64(x) + 0.5, float64(y) + 0.5}
-
-			// Compute barycentric-like coords (u,v) solving Q * [u v]^T = (p - D0)
-			rel := sub(p, D[0])
-			uv := mul2(Qinv, rel)
-			u, v := uv.X, uv.Y
-			w := 1.0 - u - v
-
-			// Inside test for triangle (allow tiny epsilon on edges)
-			if u >= -1e-6 && v >= -1e-6 && w >= -1e-6 {
-				// Map to source: s = S0 + P * [u v]
-				srcRel := delaunay.Point{
-					P[0][0]*u + P[0][1]*v,
-					P[1][0]*u + P[1][1]*v,
-				}
-				s := add(S[0], srcRel)
-
-				c := sampleBilinear(src, s.X, s.Y)
-				dst.SetNRGBA(x, y, c)
+		// Center of pixel for nicer results
+		py := float64(y) + 0.5
+
+		// Find the span of pixel centres on this scanline where all of u, v &
+		// w are inside the triangle (allowing a tiny epsilon on edges)
+		lo, hi := float64(dstBounds.Min.X)+0.5, float64(dstBounds.Max.X-1)+0.5
+		for _, e := range edges {
+			c := e[1]*py + e[2] + 1e-6
+			switch {
+			case e[0] > 0:
+				lo = math.Max(lo, -c/e[0])
+			case e[0] < 0:
+				hi = math.Min(hi, -c/e[0])
+			case c < 0:
+				hi = lo - 1
+			}
+		}
+		if hi < lo {
+			continue
+		}
+		startX := int(math.Ceil(lo - 0.5))
+		endX := int(math.Floor(hi - 0.5))
+
+		px := float64(startX) + 0.5
+		u := edges[0][0]*px + edges[0][1]*py + edges[0][2]
+		v := edges[1][0]*px + edges[1][1]*py + edges[1][2]
+		sx := S[0].X + P[0][0]*u + P[0][1]*v
+		sy := S[0].Y + P[1][0]*u + P[1][1]*v
+
+		off := dst.PixOffset(startX, y)
+		for x := startX; x <= endX; x++ {
+			pix := dst.Pix[off : off+4 : off+4]
+			if bilinear {
+				pix[0], pix[1], pix[2], pix[3] = sampleBilinearFast(src, sx, sy)
+			} else {
+				c := sampler.Sample(src, sx, sy, opts.Border)
+				pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, c.A
 			}
+			sx += stepSX
+			sy += stepSY
+			off += 4
 		}
 	}
 	return nil
 }
 
 func WarpImage(srcImg *image.NRGBA, sourcePoints, destPoints []delaunay.Point) (*image.NRGBA, error) {
+	return WarpImageOptions(srcImg, sourcePoints, destPoints, WarpOptions{})
+}
+
+// WarpImageOptions is WarpImage with control over how the source is
+// resampled. Like the samplers, the points place pixel centres at integer
+// coordinates.
+func WarpImageOptions(srcImg *image.NRGBA, sourcePoints, destPoints []delaunay.Point, opts WarpOptions) (*image.NRGBA, error) {
 	if len(sourcePoints) != len(destPoints) {
 		return nil, fmt.Errorf("source and destination point lists must have the same length")
 	}
@@ -178,11 +312,33 @@ func WarpImage(srcImg *image.NRGBA, sourcePoints, destPoints []delaunay.Point) (
 	}
 	dstImg := image.NewNRGBA(srcImg.Bounds())
 
-	for i := 0; i < len(sourcePoints); i += 3 {
-		source := [3]delaunay.Point{sourcePoints[i], sourcePoints[i+1], sourcePoints[i+2]}
-		dest := [3]delaunay.Point{destPoints[i], destPoints[i+1], destPoints[i+2]}
+	// Each band renders every triangle clipped to itself, so bands can be
+	// rendered concurrently without sharing any pixels
+	pool := opts.workers()
+	bands := pool.bands(dstImg.Bounds())
+	pool.forEach(opts.context(), len(bands), func(b int) {
+		tile := dstImg.SubImage(bands[b]).(*image.NRGBA)
+		var coverage *coverageBuffer
+		if opts.AntiAlias {
+			coverage = newCoverageBuffer(bands[b])
+		}
+
+		// The rasterizers cover pixel x with [x, x+1), so its centre is at
+		// x+0.5
+		half := delaunay.Point{X: 0.5, Y: 0.5}
+		for i := 0; i < len(sourcePoints); i += 3 {
+			source := [3]delaunay.Point{add(sourcePoints[i], half), add(sourcePoints[i+1], half), add(sourcePoints[i+2], half)}
+			dest := [3]delaunay.Point{destPoints[i], destPoints[i+1], destPoints[i+2]}
 
-		WarpTriangle(srcImg, dstImg, dest, source)
-	}
+			if coverage != nil {
+				coverage.accumulateTriangle(srcImg, dest, source, opts)
+			} else {
+				warpTriangle(srcImg, tile, dest, source, opts)
+			}
+		}
+		if coverage != nil {
+			coverage.resolve(tile)
+		}
+	})
 	return dstImg, nil
 }
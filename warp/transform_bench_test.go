@@ -102,6 +102,32 @@ func BenchmarkWarpTriangleSmall(b *testing.B) {
 	}
 }
 
+// BenchmarkWarpTriangleThin benchmarks a long thin diagonal triangle, where
+// most of the bounding box is outside the triangle
+func BenchmarkWarpTriangleThin(b *testing.B) {
+	srcImg := createTestImage(1024, 1024)
+	dstImg := image.NewNRGBA(image.Rect(0, 0, 1024, 1024))
+
+	source := [3]delaunay.Point{
+		{20, 20},
+		{1000, 980},
+		{30, 45},
+	}
+	dest := [3]delaunay.Point{
+		{10, 15},
+		{1010, 1000},
+		{25, 35},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := WarpTriangle(srcImg, dstImg, source, dest)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // BenchmarkSampleBilinear benchmarks the bilinear sampling function separately
 func BenchmarkSampleBilinear(b *testing.B) {
 	srcImg := createTestImage(512, 512)
@@ -117,11 +143,46 @@ func BenchmarkSampleBilinear(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		for _, coord := range coords {
-			_ = sampleBilinear(srcImg, coord.x, coord.y)
+			_ = sampleBilinear(srcImg, coord.x, coord.y, Border{})
+		}
+	}
+}
+
+// benchmarkSampler benchmarks a Sampler at the same coordinates as BenchmarkSampleBilinear
+func benchmarkSampler(b *testing.B, sampler Sampler) {
+	srcImg := createTestImage(512, 512)
+
+	coords := []struct{ x, y float64 }{
+		{100.5, 100.5},
+		{255.7, 255.3},
+		{400.2, 300.8},
+		{50.1, 450.9},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, coord := range coords {
+			_ = sampler.Sample(srcImg, coord.x, coord.y, Border{})
 		}
 	}
 }
 
+func BenchmarkSampleNearest(b *testing.B) {
+	benchmarkSampler(b, NearestSampler{})
+}
+
+func BenchmarkSampleCatmullRom(b *testing.B) {
+	benchmarkSampler(b, CatmullRom)
+}
+
+func BenchmarkSampleMitchell(b *testing.B) {
+	benchmarkSampler(b, Mitchell)
+}
+
+func BenchmarkSampleLanczos(b *testing.B) {
+	benchmarkSampler(b, LanczosSampler{})
+}
+
 // BenchmarkWarpImage benchmarks the full image warping with multiple triangles
 func BenchmarkWarpImage(b *testing.B) {
 	srcImg := createTestImage(512, 512)
@@ -158,6 +219,59 @@ func BenchmarkWarpImage(b *testing.B) {
 	}
 }
 
+// smoothWarpPoints returns a set of control points spread over a 512x512
+// image, and the same points displaced, for benchmarking the smooth warps
+func smoothWarpPoints() (dstPoints, srcPoints []delaunay.Point) {
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			p := delaunay.Point{X: float64(x*120 + 16), Y: float64(y*120 + 16)}
+			dstPoints = append(dstPoints, p)
+			srcPoints = append(srcPoints, delaunay.Point{X: p.X + float64((x*7+y*3)%11-5), Y: p.Y + float64((x*5+y*9)%13-6)})
+		}
+	}
+	return dstPoints, srcPoints
+}
+
+func benchmarkWarpImageMLS(b *testing.B, variant MLSVariant) {
+	srcImg := createTestImage(512, 512)
+	dstPoints, srcPoints := smoothWarpPoints()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := WarpImageMLS(srcImg, dstPoints, srcPoints, variant, WarpOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWarpImageMLSAffine(b *testing.B) {
+	benchmarkWarpImageMLS(b, MLSAffine)
+}
+
+func BenchmarkWarpImageMLSSimilarity(b *testing.B) {
+	benchmarkWarpImageMLS(b, MLSSimilarity)
+}
+
+func BenchmarkWarpImageMLSRigid(b *testing.B) {
+	benchmarkWarpImageMLS(b, MLSRigid)
+}
+
+// BenchmarkWarpImageMLSRigidExact evaluates the mapping at every pixel,
+// rather than on the default grid
+func BenchmarkWarpImageMLSRigidExact(b *testing.B) {
+	srcImg := createTestImage(512, 512)
+	dstPoints, srcPoints := smoothWarpPoints()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := WarpImageMLS(srcImg, dstPoints, srcPoints, MLSRigid, WarpOptions{GridStep: 1})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // BenchmarkMatrixOperations benchmarks the matrix math operations
 func BenchmarkMatrixOperations(b *testing.B) {
 	// Test matrices
@@ -0,0 +1,153 @@
+package warp
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/fogleman/delaunay"
+)
+
+// distortedMesh builds a jittered grid of control points over a width x height
+// image, returning the flattened triangles for the undistorted and distorted
+// layouts.
+func distortedMesh(t *testing.T, width, height int) (source, dest []delaunay.Point) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	bounds := createTestImage(width, height).Bounds()
+
+	var original, moved []delaunay.Point
+	for y := 1; y < 8; y++ {
+		for x := 1; x < 8; x++ {
+			p := delaunay.Point{X: float64(x*width) / 8, Y: float64(y*height) / 8}
+			original = append(original, p)
+			moved = append(moved, delaunay.Point{
+				X: p.X + (rng.Float64()-0.5)*float64(width)/6,
+				Y: p.Y + (rng.Float64()-0.5)*float64(height)/6,
+			})
+		}
+	}
+	original = paddedPoints(bounds, original)
+	moved = paddedPoints(bounds, moved)
+	triangulation, err := delaunay.Triangulate(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trianglePoints(moved, triangulation.Triangles), trianglePoints(original, triangulation.Triangles)
+}
+
+func TestWarpImageAntiAliasCoversHull(t *testing.T) {
+	srcImg := createTestImage(257, 193)
+	sourcePoints, destPoints := distortedMesh(t, 257, 193)
+
+	dst, err := WarpImageOptions(srcImg, sourcePoints, destPoints, WarpOptions{AntiAlias: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hull spans the padded corners, which are the outer edges of the
+	// image, and the source is opaque, so every pixel must be fully covered
+	b := dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if a := dst.NRGBAAt(x, y).A; a != 255 {
+				t.Fatalf("pixel (%d,%d) has alpha %d, want 255", x, y, a)
+			}
+		}
+	}
+}
+
+func TestWarpImageThreadsMatchSerial(t *testing.T) {
+	srcImg := createTestImage(257, 193)
+	sourcePoints, destPoints := distortedMesh(t, 257, 193)
+
+	for _, antiAlias := range []bool{false, true} {
+		serial, err := WarpImageOptions(srcImg, sourcePoints, destPoints, WarpOptions{AntiAlias: antiAlias})
+		if err != nil {
+			t.Fatal(err)
+		}
+		threaded, err := WarpImageOptions(srcImg, sourcePoints, destPoints, WarpOptions{AntiAlias: antiAlias, Threads: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(serial.Pix, threaded.Pix) {
+			t.Errorf("antialias=%v: threaded warp differs from serial", antiAlias)
+		}
+	}
+}
+
+// warpTriangleReference is the original bounding box rasterizer, which
+// warpTriangle must continue to match
+func warpTriangleReference(src *image.NRGBA, dst *image.NRGBA, S [3]delaunay.Point, D [3]delaunay.Point) {
+	P := [2][2]float64{
+		{S[1].X - S[0].X, S[2].X - S[0].X},
+		{S[1].Y - S[0].Y, S[2].Y - S[0].Y},
+	}
+	Q := [2][2]float64{
+		{D[1].X - D[0].X, D[2].X - D[0].X},
+		{D[1].Y - D[0].Y, D[2].Y - D[0].Y},
+	}
+	Qinv, ok := inv2x2(Q)
+	if !ok {
+		return
+	}
+	minX := int(math.Floor(math.Min(D[0].X, math.Min(D[1].X, D[2].X))))
+	maxX := int(math.Ceil(math.Max(D[0].X, math.Max(D[1].X, D[2].X))))
+	minY := int(math.Floor(math.Min(D[0].Y, math.Min(D[1].Y, D[2].Y))))
+	maxY := int(math.Ceil(math.Max(D[0].Y, math.Max(D[1].Y, D[2].Y))))
+	r := image.Rect(minX, minY, maxX, maxY).Intersect(dst.Bounds())
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			uv := mul2(Qinv, sub(delaunay.Point{X: float64(x) + 0.5, Y: float64(y) + 0.5}, D[0]))
+			u, v := uv.X, uv.Y
+			if u >= -1e-6 && v >= -1e-6 && 1-u-v >= -1e-6 {
+				s := add(S[0], mul2(P, uv))
+				dst.SetNRGBA(x, y, sampleBilinear(src, s.X, s.Y, Border{}))
+			}
+		}
+	}
+}
+
+func TestWarpTriangleMatchesReference(t *testing.T) {
+	srcImg := createTestImage(512, 512)
+	triangles := []struct{ S, D [3]delaunay.Point }{
+		{
+			S: [3]delaunay.Point{{X: 50, Y: 50}, {X: 200, Y: 60}, {X: 100, Y: 180}},
+			D: [3]delaunay.Point{{X: 60, Y: 40}, {X: 220, Y: 80}, {X: 90, Y: 200}},
+		},
+		{
+			// Thin diagonal sliver
+			S: [3]delaunay.Point{{X: 10, Y: 10}, {X: 500, Y: 480}, {X: 20, Y: 30}},
+			D: [3]delaunay.Point{{X: 5, Y: 2}, {X: 505, Y: 500}, {X: 9, Y: 12}},
+		},
+		{
+			// Partly outside the destination, with an axis aligned edge
+			S: [3]delaunay.Point{{X: 0, Y: 0}, {X: 300, Y: 0}, {X: 0, Y: 300}},
+			D: [3]delaunay.Point{{X: -40, Y: 100}, {X: 600, Y: 100}, {X: 100, Y: 700}},
+		},
+	}
+	for i, tri := range triangles {
+		want := image.NewNRGBA(srcImg.Bounds())
+		got := image.NewNRGBA(srcImg.Bounds())
+		warpTriangleReference(srcImg, want, tri.S, tri.D)
+		if err := WarpTriangle(srcImg, got, tri.S, tri.D); err != nil {
+			t.Fatal(err)
+		}
+
+		mismatched := 0
+		for p := 0; p < len(want.Pix); p += 4 {
+			for c := 0; c < 4; c++ {
+				diff := int(want.Pix[p+c]) - int(got.Pix[p+c])
+				if diff < -1 || diff > 1 {
+					mismatched++
+					break
+				}
+			}
+		}
+		if mismatched > 0 {
+			t.Errorf("triangle %d: %d pixels differ from the reference rasterizer", i, mismatched)
+		}
+	}
+}